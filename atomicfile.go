@@ -0,0 +1,30 @@
+package sds011
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes to temporary file, syncs and renames. File is old or new after power cut, never half written
+func writeFileAtomic(name string, data []byte) error {
+	tmpName := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	f, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	_, errW := f.Write(data)
+	if errW != nil {
+		f.Close()
+		return errW
+	}
+	syncErr := f.Sync()
+	if syncErr != nil {
+		f.Close()
+		return syncErr
+	}
+	closeErr := f.Close()
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmpName, name)
+}
@@ -0,0 +1,40 @@
+/*
+Exponential backoff for reconnecting links
+*/
+
+package sds011
+
+import "time"
+
+const (
+	RECONNECTMINBACKOFF = 500   //milliseconds, first retry delay
+	RECONNECTMAXBACKOFF = 30000 //milliseconds, delay is doubled up to this
+)
+
+type Backoff struct {
+	Min  time.Duration
+	Max  time.Duration
+	next time.Duration
+}
+
+func DefaultBackoff() Backoff {
+	return Backoff{Min: time.Millisecond * RECONNECTMINBACKOFF, Max: time.Millisecond * RECONNECTMAXBACKOFF}
+}
+
+// Next gives delay before next try and doubles delay for try after that
+func (p *Backoff) Next() time.Duration {
+	if p.next < p.Min {
+		p.next = p.Min
+	}
+	result := p.next
+	p.next *= 2
+	if p.Max < p.next {
+		p.next = p.Max
+	}
+	return result
+}
+
+// Reset after successful connect
+func (p *Backoff) Reset() {
+	p.next = 0
+}
@@ -0,0 +1,175 @@
+/*
+Bus shares one Conn between multiple SDS011 sensors (like uart<->RS485 with several sensors on same wires)
+
+Bus reads packets from conn only once and routes them by device ID to registered sensors.
+Requests from sensors are serialized. Only one request is in flight on half duplex line
+*/
+
+package sds011
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BUSPORTWAIT = 100 //milliseconds, how long sensor side Recieve waits for packet before returning nil
+)
+
+type Bus struct {
+	conn Conn
+
+	txLock sync.Mutex //Held by sensor while its request is waiting reply
+
+	mu    sync.Mutex //Guards ports and tap
+	ports []*busPort
+	tap   chan Packet //All responses are copied here while bus level request (like Discover) is running
+
+	UnknownIds        chan uint16 //Valid packet from ID that is not registered on bus. Not pushed if full
+	ErrorsCh          chan error  //Recoverable errors from conn. Not pushed if full
+	recoverableErrors int64       //Atomic
+}
+
+// busPort is sensor's view to bus. Implements Conn
+type busPort struct {
+	bus *Bus
+	id  uint16
+	rx  chan Packet
+}
+
+func NewBus(conn Conn) *Bus {
+	return &Bus{
+		conn:       conn,
+		ports:      []*busPort{},
+		UnknownIds: make(chan uint16, 10),
+		ErrorsCh:   make(chan error, 2),
+	}
+}
+
+/*
+AddSensor creates sensor that is listening given ID on this bus. Parameters are same as in InitSds011
+Packets are routed by ID given here, changing Id of sensor later do not change routing
+*/
+func (p *Bus) AddSensor(id uint16, passive bool, resultCh chan Result, initialMeasurementCounter int) *Sds011 {
+	port := &busPort{
+		bus: p,
+		id:  id,
+		rx:  make(chan Packet, 4),
+	}
+	p.mu.Lock()
+	p.ports = append(p.ports, port)
+	p.mu.Unlock()
+
+	sensor := InitSds011(id, passive, port, resultCh, initialMeasurementCounter)
+	sensor.txLock = &p.txLock
+	return &sensor
+}
+
+// RemoveSensor stops routing packets to sensor. Same as closing sensor's conn
+func (p *Bus) RemoveSensor(sensor *Sds011) {
+	port, isPort := sensor.conn.(*busPort)
+	if isPort && port.bus == p {
+		port.Close()
+	}
+}
+
+func (p *Bus) removePort(port *busPort) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, v := range p.ports {
+		if v == port {
+			p.ports = append(p.ports[:i], p.ports[i+1:]...)
+			return
+		}
+	}
+}
+
+// Routes packet to all sensors with matching id. Sensor that is not keeping up loses packet
+func (p *Bus) route(pack Packet) {
+	if !pack.Valid {
+		return
+	}
+	matched := false
+	p.mu.Lock()
+	if p.tap != nil && pack.CommandID == COMMANDID_RESPONSE {
+		select {
+		case p.tap <- pack:
+		default:
+		}
+	}
+	for _, port := range p.ports {
+		if pack.MatchToId(port.id) {
+			matched = true
+			select {
+			case port.rx <- pack:
+			default:
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if !matched && len(p.UnknownIds) < cap(p.UnknownIds) {
+		p.UnknownIds <- pack.DeviceID
+	}
+}
+
+// RecoverableErrorCount tells how many bad frames etc.. Run have reported on ErrorsCh and continued
+func (p *Bus) RecoverableErrorCount() int64 {
+	return atomic.LoadInt64(&p.recoverableErrors)
+}
+
+/*
+Run reads conn and routes packets until ctx is done or conn fails.
+Recoverable errors are reported on ErrorsCh like in Sds011.Run.
+Sensors added on bus must run their own Run
+*/
+func (p *Bus) Run(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		packet, errRecv := p.conn.Recieve()
+		if errRecv != nil {
+			if !IsRecoverable(errRecv) {
+				return errRecv
+			}
+			atomic.AddInt64(&p.recoverableErrors, 1)
+			select {
+			case p.ErrorsCh <- errRecv:
+			default:
+			}
+			continue
+		}
+		if packet != nil {
+			p.route(*packet)
+		}
+	}
+}
+
+// Close closes underlying conn
+func (p *Bus) Close() error {
+	return p.conn.Close()
+}
+
+func (p *busPort) Send(packet Packet) error {
+	return p.bus.conn.Send(packet)
+}
+
+func (p *busPort) Recieve() (*Packet, error) {
+	timer := time.NewTimer(time.Millisecond * BUSPORTWAIT)
+	defer timer.Stop()
+	select {
+	case pack := <-p.rx:
+		return &pack, nil
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// Close removes port from bus. Bus conn stays open
+func (p *busPort) Close() error {
+	p.bus.removePort(p)
+	return nil
+}
@@ -0,0 +1,79 @@
+package sds011
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Feeds given packets to reciever, then nothing
+type listConn struct {
+	packets chan Packet
+	errs    chan error //Optional
+	sent    chan Packet
+}
+
+func (p *listConn) Send(packet Packet) error {
+	p.sent <- packet
+	return nil
+}
+
+func (p *listConn) Recieve() (*Packet, error) {
+	select {
+	case err := <-p.errs:
+		return nil, err
+	case pack := <-p.packets:
+		return &pack, nil
+	case <-time.After(10 * time.Millisecond):
+		return nil, nil
+	}
+}
+
+func (p *listConn) Close() error {
+	return nil
+}
+
+func TestBusRouting(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	bus := NewBus(conn)
+
+	resultsA := make(chan Result, 3)
+	resultsB := make(chan Result, 3)
+	sensorA := bus.AddSensor(0xA160, true, resultsA, 0)
+	sensorB := bus.AddSensor(0xA161, true, resultsB, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go bus.Run(ctx)
+	go sensorA.Run(ctx)
+	go sensorB.Run(ctx)
+
+	conn.packets <- NewPacket_DataReply(0xA160, 10, 20)
+	conn.packets <- NewPacket_DataReply(0xA161, 30, 40)
+	conn.packets <- NewPacket_DataReply(0x1234, 50, 60)
+
+	select {
+	case res := <-resultsA:
+		if res.SmallReg != 10 || res.LargeReg != 20 {
+			t.Errorf("sensor A got wrong result %#v", res)
+		}
+	case <-ctx.Done():
+		t.Fatalf("sensor A did not get result")
+	}
+	select {
+	case res := <-resultsB:
+		if res.SmallReg != 30 || res.LargeReg != 40 {
+			t.Errorf("sensor B got wrong result %#v", res)
+		}
+	case <-ctx.Done():
+		t.Fatalf("sensor B did not get result")
+	}
+	select {
+	case id := <-bus.UnknownIds:
+		if id != 0x1234 {
+			t.Errorf("unknown id %X reported", id)
+		}
+	case <-ctx.Done():
+		t.Fatalf("unknown id not reported")
+	}
+}
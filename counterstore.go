@@ -0,0 +1,94 @@
+/*
+Measurement counter persistence
+
+Sensor wears down in each run, so counter must continue from where it was after restart.
+Counter is stored per device ID, so multi-sensor setups do not share one file
+*/
+
+package sds011
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	COUNTERFLUSHINTERVAL = 10000 //milliseconds, default minimum time between counter saves
+)
+
+type CounterStore interface {
+	LoadCounter(id uint16) (int, error) //Zero if nothing stored yet
+	SaveCounter(id uint16, counter int) error
+}
+
+/*
+In memory store. For tests and for systems without storage
+*/
+type MemoryCounterStore struct {
+	mu       sync.Mutex
+	counters map[uint16]int
+}
+
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{counters: make(map[uint16]int)}
+}
+
+func (p *MemoryCounterStore) LoadCounter(id uint16) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counters[id], nil
+}
+
+func (p *MemoryCounterStore) SaveCounter(id uint16, counter int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counters[id] = counter
+	return nil
+}
+
+/*
+File store writes one file per device ID in Dir. File have counter as decimal text
+
+LegacyFile is optional single-sensor counter file (like "measuredcounter" written by older simpleExample).
+It is read when ID does not have own file yet, so counting continues after upgrade. Next save goes to per-ID file
+*/
+type FileCounterStore struct {
+	Dir        string
+	LegacyFile string
+}
+
+func (p FileCounterStore) fileName(id uint16) string {
+	return filepath.Join(p.Dir, fmt.Sprintf("measuredcounter_%04X", id))
+}
+
+func readCounterFile(fileName string) (int, error) {
+	byt, errRead := os.ReadFile(fileName)
+	if errRead != nil {
+		if errors.Is(errRead, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, errRead
+	}
+	i, parseErr := strconv.ParseInt(strings.TrimSpace(string(byt)), 10, 64)
+	if parseErr != nil {
+		return 0, fmt.Errorf("error parsing counter from file %v: %w", fileName, parseErr)
+	}
+	return int(i), nil
+}
+
+func (p FileCounterStore) LoadCounter(id uint16) (int, error) {
+	_, errStat := os.Stat(p.fileName(id))
+	if p.LegacyFile != "" && errors.Is(errStat, os.ErrNotExist) {
+		return readCounterFile(filepath.Join(p.Dir, p.LegacyFile))
+	}
+	return readCounterFile(p.fileName(id))
+}
+
+func (p FileCounterStore) SaveCounter(id uint16, counter int) error {
+	return writeFileAtomic(p.fileName(id), []byte(strconv.Itoa(counter)))
+}
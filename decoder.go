@@ -0,0 +1,122 @@
+/*
+Streaming frame decoder
+
+Reads bytes from any io.Reader and finds frames without allocating. Frame length is known from command ID
+(19 bytes for CMD, 10 for RESPONSE and DATAREPLY). Candidate is checked (termination, checksum, function)
+before bytes are consumed. On bad candidate only header byte is dropped and scanning continues from next 0xAA,
+so valid frame is never lost even if junk or payload contains 0xAA. Works on TinyGo too
+*/
+
+package sds011
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	DECODERBUFSIZE = 64 //Must fit at least one SDS011TOSENSORSIZE frame
+)
+
+type Decoder struct {
+	Clock func() int64 //Uptime in milliseconds for Packet.Uptime. Zero if nil
+
+	r          io.Reader
+	buf        [DECODERBUFSIZE]byte
+	start, end int //Unprocessed bytes are buf[start:end]
+	stats      *linkCounters
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, stats: newLinkCounters()}
+}
+
+// Stats counts frames, discarded bytes and bad candidates
+func (p *Decoder) Stats() LinkStats {
+	return p.stats.snapshot()
+}
+
+func (p *Decoder) discard(n int) {
+	p.start += n
+	p.stats.discarded(n)
+	if p.start == p.end {
+		p.start, p.end = 0, 0
+	}
+}
+
+// Tries to decode frame from already buffered bytes
+func (p *Decoder) parseBuffered(pack *Packet) (bool, error) {
+	iStart := bytes.IndexByte(p.buf[p.start:p.end], SDS011PACKETSTART)
+	if iStart < 0 {
+		p.discard(p.end - p.start)
+		return false, nil
+	}
+	p.discard(iStart)
+	if p.end-p.start < 2 {
+		return false, nil
+	}
+
+	frameLen := SDS011FROMSENSORSIZE
+	switch p.buf[p.start+1] {
+	case COMMANDID_CMD:
+		frameLen = SDS011TOSENSORSIZE
+	case COMMANDID_RESPONSE, COMMANDID_DATAREPLY:
+	default:
+		commandID := p.buf[p.start+1]
+		p.discard(1)
+		errFrame := &FrameError{Offset: 1, Reason: fmt.Sprintf("command ID 0x%X is not supported", commandID)}
+		p.stats.parseError(errFrame)
+		return false, errFrame
+	}
+	if p.end-p.start < frameLen {
+		return false, nil
+	}
+
+	data := pack.Data[:0] //Reuse callers storage
+	uptime := int64(0)
+	if p.Clock != nil {
+		uptime = p.Clock()
+	}
+	errParse := pack.FromBytes(uptime, p.buf[p.start:p.start+frameLen])
+	pack.Data = append(data, pack.Data...) //Do not point to decoder buffer
+	if errParse != nil {
+		p.discard(1)
+		p.stats.parseError(errParse)
+		return false, errParse
+	}
+	p.start += frameLen
+	if p.start == p.end {
+		p.start, p.end = 0, 0
+	}
+	p.stats.frame(pack.CommandID)
+	return true, nil
+}
+
+/*
+Decode fills pack and returns true when frame is found. Reads from reader once if buffered bytes are not enough.
+Bad candidate is returned as recoverable error (see IsRecoverable), call again for continuing.
+pack.Data capacity is reused, pass same Packet for allocation free decoding.
+Read errors are returned as is, io.EOF included
+*/
+func (p *Decoder) Decode(pack *Packet) (bool, error) {
+	found, errParse := p.parseBuffered(pack)
+	if found || errParse != nil {
+		return found, errParse
+	}
+
+	if p.end == len(p.buf) { //Partial frame at the end, make room
+		p.end = copy(p.buf[:], p.buf[p.start:p.end])
+		p.start = 0
+	}
+	n, errRead := p.r.Read(p.buf[p.end:])
+	p.end += n
+	if n == 0 {
+		return false, errRead
+	}
+	found, errParse = p.parseBuffered(pack)
+	if found || errParse != nil {
+		return found, errParse
+	}
+	return false, errRead
+}
@@ -0,0 +1,80 @@
+package sds011
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoderResync(t *testing.T) {
+	withAA := NewPacket_DataReply(0xAAAA, 0xAA, 0xAAAA) //Payload and ID full of headers
+	cmd := NewPacket_QueryData(0xA160)
+	reply := NewPacket_SetWorkModeReply(0xA160, true, true)
+	good := NewPacket_DataReply(0xA160, 1, 2)
+	broken := good.ToBytes()
+	broken[3]++ //Checksum mismatch
+
+	var line []byte
+	line = append(line, 0xAA, 0x55, 0xAA) //Junk with headers
+	line = append(line, withAA.ToBytes()...)
+	line = append(line, broken...)
+	line = append(line, cmd.ToBytes()...)
+	line = append(line, reply.ToBytes()...) //Back to back
+	want := []Packet{withAA, cmd, reply}
+
+	for name, r := range map[string]io.Reader{"whole": bytes.NewReader(line), "onebyte": iotest.OneByteReader(bytes.NewReader(line))} {
+		dec := NewDecoder(r)
+		var got []Packet
+		nErrors := 0
+		for {
+			pack := Packet{}
+			found, err := dec.Decode(&pack)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if !IsRecoverable(err) {
+					t.Fatalf("%v: fatal error %v", name, err)
+				}
+				nErrors++
+				continue
+			}
+			if found {
+				got = append(got, pack)
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%v: got %v frames, want %v", name, len(got), len(want))
+		}
+		for i := range want {
+			if !bytes.Equal(got[i].ToBytes(), want[i].ToBytes()) {
+				t.Errorf("%v: frame %v is %s, want %s", name, i, got[i], want[i])
+			}
+		}
+		if nErrors == 0 || dec.Stats().ChecksumErrors != 1 {
+			t.Errorf("%v: bad candidates not reported, %v", name, dec.Stats())
+		}
+	}
+}
+
+func TestDecoderAllocs(t *testing.T) {
+	reply := NewPacket_DataReply(0xA160, 10, 20)
+	frame := reply.ToBytes()
+	r := bytes.NewReader(nil)
+	dec := NewDecoder(r)
+	pack := Packet{Data: make([]byte, 0, 16)}
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Reset(frame)
+		found, err := dec.Decode(&pack)
+		if !found || err != nil {
+			t.Fatalf("decode failed %v", err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("decode allocates %v times", allocs)
+	}
+	if pack.CommandID != COMMANDID_DATAREPLY {
+		t.Errorf("invalid packet %s", pack)
+	}
+}
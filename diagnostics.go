@@ -0,0 +1,139 @@
+/*
+Sensor health diagnostics from reading patterns
+
+Dying SDS011 often reports same values forever, zeros or saturation value 999.9.
+PM2.5 can not be larger than PM10 (PM10 includes PM2.5 particles).
+Feed results to Diagnostics, problems are reported on Events channel when they start and when they clear
+*/
+
+package sds011
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DIAGFROZENSAMPLES    = 30 //Exactly same reading this many times in row
+	DIAGZEROSAMPLES      = 20
+	DIAGSATURATEDSAMPLES = 5
+	DIAGRATIOSAMPLES     = 3
+	SATURATIONREG        = 9999 //999.9µg/m³ max reading
+)
+
+type HealthProblem int
+
+const (
+	HEALTH_FROZEN HealthProblem = iota
+	HEALTH_ZEROS
+	HEALTH_SATURATED
+	HEALTH_RATIO
+	nHealthProblems
+)
+
+func (p HealthProblem) String() string {
+	switch p {
+	case HEALTH_FROZEN:
+		return "frozen"
+	case HEALTH_ZEROS:
+		return "zeros"
+	case HEALTH_SATURATED:
+		return "saturated"
+	case HEALTH_RATIO:
+		return "PM2.5>PM10"
+	}
+	return fmt.Sprintf("problem %d", int(p))
+}
+
+type HealthEvent struct {
+	Problem HealthProblem
+	Active  bool //False when problem have cleared
+	Reason  string
+	Time    time.Time
+}
+
+func (p HealthEvent) String() string {
+	if p.Active {
+		return fmt.Sprintf("%v: %v", p.Problem, p.Reason)
+	}
+	return fmt.Sprintf("%v cleared: %v", p.Problem, p.Reason)
+}
+
+type Diagnostics struct {
+	Limits [nHealthProblems]int //Samples in row before problem is reported. Defaults from DIAG* constants
+	Events chan HealthEvent     //Not pushed if full
+
+	runs     [nHealthProblems]int
+	active   [nHealthProblems]bool
+	previous Result
+	havePrev bool
+}
+
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{
+		Limits: [nHealthProblems]int{
+			HEALTH_FROZEN:    DIAGFROZENSAMPLES,
+			HEALTH_ZEROS:     DIAGZEROSAMPLES,
+			HEALTH_SATURATED: DIAGSATURATEDSAMPLES,
+			HEALTH_RATIO:     DIAGRATIOSAMPLES,
+		},
+		Events: make(chan HealthEvent, 10),
+	}
+}
+
+func (p *Diagnostics) update(problem HealthProblem, condition bool, reason string) {
+	if condition {
+		p.runs[problem]++
+	} else {
+		p.runs[problem] = 0
+	}
+	nowActive := p.Limits[problem] <= p.runs[problem]
+	if nowActive == p.active[problem] {
+		return
+	}
+	p.active[problem] = nowActive
+	if !nowActive {
+		reason = "normal readings"
+	}
+	select {
+	case p.Events <- HealthEvent{Problem: problem, Active: nowActive, Reason: reason, Time: time.Now()}:
+	default:
+	}
+}
+
+// Feed checks one result. Held warm-up results are skipped, those repeat earlier reading on purpose
+func (p *Diagnostics) Feed(res Result) {
+	if res.Quality == QUALITY_HELD {
+		return
+	}
+	zeros := res.SmallReg == 0 && res.LargeReg == 0
+	saturated := SATURATIONREG <= res.SmallReg || SATURATIONREG <= res.LargeReg
+	same := p.havePrev && res.SmallReg == p.previous.SmallReg && res.LargeReg == p.previous.LargeReg
+
+	if !same {
+		p.runs[HEALTH_FROZEN] = 0 //Different reading starts new run
+	}
+	p.update(HEALTH_FROZEN, !zeros && !saturated, fmt.Sprintf("same reading %v times, PM2.5=%.1f PM10=%.1f", p.runs[HEALTH_FROZEN]+1, res.Small(), res.Large()))
+	p.update(HEALTH_ZEROS, zeros, fmt.Sprintf("zero reading %v times", p.runs[HEALTH_ZEROS]+1))
+	p.update(HEALTH_SATURATED, saturated, fmt.Sprintf("saturated reading %v times, PM2.5=%.1f PM10=%.1f", p.runs[HEALTH_SATURATED]+1, res.Small(), res.Large()))
+	p.update(HEALTH_RATIO, res.LargeReg < res.SmallReg, fmt.Sprintf("PM2.5=%.1f larger than PM10=%.1f", res.Small(), res.Large()))
+
+	p.previous = res
+	p.havePrev = true
+}
+
+// Problems that are active now
+func (p *Diagnostics) Problems() []HealthProblem {
+	var result []HealthProblem
+	for problem, active := range p.active {
+		if active {
+			result = append(result, HealthProblem(problem))
+		}
+	}
+	return result
+}
+
+// Healthy if no problems are active
+func (p *Diagnostics) Healthy() bool {
+	return len(p.Problems()) == 0
+}
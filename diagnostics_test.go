@@ -0,0 +1,54 @@
+package sds011
+
+import (
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	diag := NewDiagnostics()
+	expect := func(problem HealthProblem, active bool) {
+		t.Helper()
+		select {
+		case ev := <-diag.Events:
+			if ev.Problem != problem || ev.Active != active {
+				t.Fatalf("expected %v active=%v, got %v", problem, active, ev)
+			}
+		default:
+			t.Fatalf("no event for %v active=%v", problem, active)
+		}
+	}
+
+	for i := 0; i < DIAGFROZENSAMPLES-1; i++ {
+		diag.Feed(Result{SmallReg: 123, LargeReg: 456})
+	}
+	if len(diag.Events) != 0 {
+		t.Fatalf("frozen reported before %v same readings, %v", DIAGFROZENSAMPLES, <-diag.Events)
+	}
+	diag.Feed(Result{SmallReg: 123, LargeReg: 456})
+	expect(HEALTH_FROZEN, true)
+	diag.Feed(Result{SmallReg: 124, LargeReg: 456})
+	expect(HEALTH_FROZEN, false)
+
+	for i := 0; i < DIAGZEROSAMPLES; i++ {
+		diag.Feed(Result{})
+	}
+	expect(HEALTH_ZEROS, true)
+	if len(diag.Events) != 0 {
+		t.Errorf("zeros reported also as %v", <-diag.Events)
+	}
+
+	for i := 0; i < DIAGSATURATEDSAMPLES; i++ {
+		diag.Feed(Result{SmallReg: 200, LargeReg: SATURATIONREG})
+	}
+	expect(HEALTH_ZEROS, false)
+	expect(HEALTH_SATURATED, true)
+
+	for i := 0; i < DIAGRATIOSAMPLES; i++ {
+		diag.Feed(Result{SmallReg: 300 + uint16(i), LargeReg: 100})
+	}
+	expect(HEALTH_SATURATED, false)
+	expect(HEALTH_RATIO, true)
+	if diag.Healthy() {
+		t.Errorf("healthy while PM2.5>PM10")
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Discovery scan for finding all sensors on bus
+
+Broadcast version query is sent to ANYDEVICE and all replies are collected in listen window.
+Then each found sensor is queried for its settings.
+
+NOTICE: on shared RS485 line replies from multiple sensors can collide. Sensor with garbled reply is not found. Run scan again if needed
+*/
+
+package sds011
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	DISCOVERYWINDOW = 2000 //milliseconds, how long replies for broadcast version query are collected
+)
+
+type DeviceInfo struct {
+	ID        uint16
+	Version   string
+	QueryMode bool
+	Period    byte
+	Working   bool
+}
+
+func (p DeviceInfo) String() string {
+	workString := "SLEEP"
+	if p.Working {
+		workString = "WORK"
+	}
+	modeString := "ACTIVE"
+	if p.QueryMode {
+		modeString = "QUERY"
+	}
+	return fmt.Sprintf("%04X version:%v mode:%v period=%v %v", p.ID, p.Version, modeString, p.Period, workString)
+}
+
+func (p *Bus) setTap(tap chan Packet) {
+	p.mu.Lock()
+	p.tap = tap
+	p.mu.Unlock()
+}
+
+// For bus level requests, answer is matched by device ID and function number
+func (p *Bus) request(ctx context.Context, tap chan Packet, query Packet) (Packet, error) {
+	for 0 < len(tap) {
+		<-tap //Clear up
+	}
+
+	sendErr := p.conn.Send(query)
+	if sendErr != nil {
+		return Packet{}, sendErr
+	}
+
+	tStart := time.Now()
+	ctxResponse, cancel := context.WithTimeout(ctx, time.Millisecond*TIMEOUTRESPONSE)
+	defer cancel()
+	for {
+		select {
+		case reply := <-tap:
+			if reply.DeviceID == query.DeviceID && reply.Data[0] == query.Data[0] {
+				return reply, nil
+			}
+		case <-ctxResponse.Done():
+			if ctx.Err() != nil {
+				return Packet{}, ctx.Err()
+			}
+			return Packet{}, fmt.Errorf("%w, no reply in %s", ErrTimeout, time.Since(tStart))
+		}
+	}
+}
+
+// Reads settings of one sensor for DeviceInfo
+func (p *Bus) queryDeviceInfo(ctx context.Context, tap chan Packet, info *DeviceInfo) error {
+	reply, errReply := p.request(ctx, tap, NewPacket_SetQueryMode(info.ID, false, false))
+	if errReply != nil {
+		return errReply
+	}
+	queryMode, errQueryMode := reply.GetQueryMode()
+	if errQueryMode != nil {
+		return errQueryMode
+	}
+
+	reply, errReply = p.request(ctx, tap, NewPacket_SetPeriod(info.ID, false, 0))
+	if errReply != nil {
+		return errReply
+	}
+	period, errPeriod := reply.GetPeriod()
+	if errPeriod != nil {
+		return errPeriod
+	}
+
+	reply, errReply = p.request(ctx, tap, NewPacket_SetWorkMode(info.ID, false, false))
+	if errReply != nil {
+		return errReply
+	}
+	working, errWorking := reply.GetWorkMode()
+	if errWorking != nil {
+		return errWorking
+	}
+
+	info.QueryMode = queryMode
+	info.Period = period
+	info.Working = working
+	return nil
+}
+
+/*
+Discover lists every sensor replying on bus, sorted by ID. Bus must be running.
+If settings query of some sensor fails, it is still listed (with zero settings) and error is returned
+*/
+func (p *Bus) Discover(ctx context.Context) ([]DeviceInfo, error) {
+	p.txLock.Lock()
+	defer p.txLock.Unlock()
+
+	tap := make(chan Packet, 32)
+	p.setTap(tap)
+	defer p.setTap(nil)
+
+	sendErr := p.conn.Send(NewPacket_QueryVersion(ANYDEVICE))
+	if sendErr != nil {
+		return nil, sendErr
+	}
+
+	found := make(map[uint16]DeviceInfo)
+	ctxWindow, cancel := context.WithTimeout(ctx, time.Millisecond*DISCOVERYWINDOW)
+	defer cancel()
+	for ctxWindow.Err() == nil {
+		select {
+		case reply := <-tap:
+			version, errVersion := reply.GetVersionString()
+			if errVersion != nil {
+				continue //Some other response
+			}
+			found[reply.DeviceID] = DeviceInfo{ID: reply.DeviceID, Version: version}
+		case <-ctxWindow.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	result := make([]DeviceInfo, 0, len(found))
+	for _, info := range found {
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+	var errs []error
+	for i := range result {
+		errInfo := p.queryDeviceInfo(ctx, tap, &result[i])
+		if errInfo != nil {
+			errs = append(errs, fmt.Errorf("sensor %04X: %w", result[i].ID, errInfo))
+		}
+	}
+	return result, errors.Join(errs...)
+}
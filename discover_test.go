@@ -0,0 +1,77 @@
+package sds011
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Several fake sensors on same line. First sensor sends its reply to broadcast twice
+type multiSensorConn struct {
+	sensors []*fakeSensorConn
+	replies chan Packet
+}
+
+func newMultiSensorConn(ids ...uint16) *multiSensorConn {
+	result := &multiSensorConn{replies: make(chan Packet, 20)}
+	for _, id := range ids {
+		sensor := newFakeSensorConn(id)
+		sensor.replies = result.replies
+		result.sensors = append(result.sensors, sensor)
+	}
+	return result
+}
+
+func (p *multiSensorConn) Send(packet Packet) error {
+	for _, sensor := range p.sensors {
+		if packet.MatchToId(sensor.id) {
+			sensor.Send(packet)
+		}
+	}
+	if packet.DeviceID == ANYDEVICE && packet.Data[0] == FUNNUMBER_VERSION {
+		p.replies <- NewPacket_QueryVersionReply(p.sensors[0].id, 19, 9, 28)
+	}
+	return nil
+}
+
+func (p *multiSensorConn) Recieve() (*Packet, error) {
+	select {
+	case pack := <-p.replies:
+		return &pack, nil
+	case <-time.After(10 * time.Millisecond):
+		return nil, nil
+	}
+}
+
+func (p *multiSensorConn) Close() error {
+	return nil
+}
+
+func TestDiscover(t *testing.T) {
+	conn := newMultiSensorConn(0xA161, 0xA160)
+	conn.sensors[0].queryMode = true
+	conn.sensors[0].period = 5
+	conn.sensors[1].working = false
+
+	bus := NewBus(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go bus.Run(ctx)
+
+	found, errDiscover := bus.Discover(ctx)
+	if errDiscover != nil {
+		t.Fatal(errDiscover)
+	}
+	want := []DeviceInfo{
+		{ID: 0xA160, Version: "19.9.28", QueryMode: false, Period: 0, Working: false},
+		{ID: 0xA161, Version: "19.9.28", QueryMode: true, Period: 5, Working: true},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("found %v, expected %v", found, want)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("found %v, expected %v", found[i], want[i])
+		}
+	}
+}
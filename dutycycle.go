@@ -0,0 +1,164 @@
+/*
+Software duty cycle
+
+Sensor own period setting is limited to whole minutes 0-30 and it is stored on flash.
+DutyCycle keeps sensor sleeping and wakes it WarmUp before each Schedule slot with work/sleep commands.
+At slot time it takes Samples data queries, averages them and puts sensor back to sleep.
+Sensor must be in query mode, otherwise spontanious readings would mix with averages. Run checks that
+*/
+
+package sds011
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DUTYSAMPLES        = 3
+	DUTYSAMPLEINTERVAL = 1000 //milliseconds, sensor updates reading once per second
+	DUTYSLEEPTIMEOUT   = 2000 //milliseconds, for putting sensor to sleep when stopping
+)
+
+type DutyCycle struct {
+	Schedule       Schedule
+	WarmUp         time.Duration //Sensor is woken up this much before slot
+	Samples        int
+	SampleInterval time.Duration
+
+	sensor *Sds011
+}
+
+func NewDutyCycle(sensor *Sds011, schedule Schedule) *DutyCycle {
+	return &DutyCycle{
+		Schedule:       schedule,
+		WarmUp:         time.Millisecond * WARMUPTIME,
+		Samples:        DUTYSAMPLES,
+		SampleInterval: time.Millisecond * DUTYSAMPLEINTERVAL,
+		sensor:         sensor,
+	}
+}
+
+// Returns false if ctx was done
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+/*
+Cycle wakes sensor, waits warm-up and slot time, takes samples and puts sensor back to sleep.
+Averaged result counts as one measurement, counter is not estimated from period while cycle runs.
+Result.Slot is set to slot, Result.Time is time of last sample. WarmUp policy of sensor is not applied here, Run does that.
+If only putting sensor back to sleep fails, averaged result is returned with error
+*/
+func (p *DutyCycle) Cycle(ctx context.Context, slot time.Time) (Result, error) {
+	if p.Samples < 1 {
+		return Result{}, fmt.Errorf("invalid sample count %v", p.Samples)
+	}
+	atomic.AddInt32(&p.sensor.manualCounting, 1)
+	defer atomic.AddInt32(&p.sensor.manualCounting, -1)
+	errWake := p.sensor.ChangeToWork(ctx, true)
+	if errWake != nil {
+		return Result{}, errWake
+	}
+	if !sleepCtx(ctx, max(p.WarmUp, time.Until(slot))) {
+		return Result{}, ctx.Err()
+	}
+
+	var sumSmall, sumLarge int
+	result := Result{Slot: slot}
+	for i := 0; i < p.Samples; i++ {
+		if 0 < i && !sleepCtx(ctx, p.SampleInterval) {
+			return Result{}, ctx.Err()
+		}
+		sample, errQuery := p.sensor.QueryMeasurement(ctx)
+		if errQuery != nil {
+			return Result{}, errQuery
+		}
+		sumSmall += int(sample.SmallReg)
+		sumLarge += int(sample.LargeReg)
+		if result.Quality == QUALITY_STABLE {
+			result.Quality = sample.Quality
+		}
+		result.Uptime = sample.Uptime
+		result.Time = sample.Time
+	}
+
+	errSleep := p.sensor.ChangeToWork(ctx, false)
+	if errSleep != nil {
+		errSleep = fmt.Errorf("sleep after sampling failed %w", errSleep)
+	}
+
+	result.SmallReg = uint16((sumSmall + p.Samples/2) / p.Samples)
+	result.LargeReg = uint16((sumLarge + p.Samples/2) / p.Samples)
+	result.MeasurementCounter = p.sensor.addMeasurements(1)
+	if p.sensor.wear != nil {
+		result.Wear = p.sensor.wear.Status()
+	}
+	return result, errSleep
+}
+
+/*
+Run puts sensor to sleep and runs cycles until ctx is done. Sensor Run must be running and sensor in query mode
+(settings known from SetSettings or SyncSettingsFromDevice).
+Averaged results are pushed to sensor result channel by sensor WarmUp policy, failed cycles are reported on sensor ErrorsCh.
+Measurement counter is increased once per cycle while DutyCycle runs. Sensor is put to sleep when stopping
+*/
+func (p *DutyCycle) Run(ctx context.Context) error {
+	if p.sensor.PassiveMode {
+		return ErrPassiveMode
+	}
+	if p.Schedule == nil {
+		return fmt.Errorf("no schedule")
+	}
+	if !p.sensor.currentSettings().QueryMode {
+		return fmt.Errorf("duty cycle needs query mode, sensor %04X is in active mode", p.sensor.Id)
+	}
+	atomic.AddInt32(&p.sensor.manualCounting, 1) //Also between cycles, sensor might send data when waking up
+	defer atomic.AddInt32(&p.sensor.manualCounting, -1)
+	defer func() {
+		ctxSleep, cancel := context.WithTimeout(context.Background(), time.Millisecond*DUTYSLEEPTIMEOUT)
+		defer cancel()
+		p.sensor.ChangeToWork(ctxSleep, false)
+	}()
+
+	errSleep := p.sensor.ChangeToWork(ctx, false)
+	if errSleep != nil && ctx.Err() == nil {
+		p.sensor.reportError(fmt.Errorf("duty cycle sleep failed %w", errSleep))
+	}
+	for {
+		slot := p.Schedule.Next(time.Now().Add(p.WarmUp)) //Must have time for warm-up
+		if slot.IsZero() {
+			return fmt.Errorf("schedule have no more slots")
+		}
+		if !sleepCtx(ctx, time.Until(slot.Add(-p.WarmUp))) {
+			return ctx.Err()
+		}
+		result, errCycle := p.Cycle(ctx, slot)
+		if errCycle != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !result.Slot.IsZero() { //Samples were taken, even if sleep failed after those
+			pushResult, keep := p.sensor.applyWarmUp(result)
+			if keep {
+				select {
+				case p.sensor.resultCh <- pushResult:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		if errCycle != nil {
+			p.sensor.reportError(fmt.Errorf("duty cycle failed %w", errCycle))
+			p.sensor.ChangeToWork(ctx, false) //Try not to leave sensor running
+		}
+	}
+}
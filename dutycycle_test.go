@@ -0,0 +1,143 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDutyCycle(t *testing.T) {
+	conn := newFakeSensorConn(0xA160)
+	conn.queryMode = true
+	results := make(chan Result, 10)
+	sensor := InitSds011(0xA160, false, conn, results, 7)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+	if err := sensor.SyncSettingsFromDevice(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cycle := NewDutyCycle(&sensor, IntervalSchedule{Interval: 100 * time.Millisecond})
+	cycle.WarmUp = 10 * time.Millisecond
+	cycle.SampleInterval = time.Millisecond
+	go cycle.Run(ctx)
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case res := <-results:
+			if res.SmallReg != 100 || res.LargeReg != 200 {
+				t.Errorf("invalid average %#v", res)
+			}
+			if res.Slot.IsZero() || res.Time.Before(res.Slot) || res.Slot.Truncate(100*time.Millisecond) != res.Slot {
+				t.Errorf("invalid slot %v for time %v", res.Slot, res.Time)
+			}
+			if res.MeasurementCounter != 7+i {
+				t.Errorf("cycle %v counter is %v", i, res.MeasurementCounter)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no result from cycle %v", i)
+		}
+	}
+	conn.mu.Lock()
+	working := conn.working
+	conn.mu.Unlock()
+	if working {
+		t.Errorf("sensor left working after cycle")
+	}
+}
+
+func TestDutyCycleDirect(t *testing.T) {
+	conn := newFakeSensorConn(0xA160)
+	conn.queryMode = true
+	results := make(chan Result, 10)
+	sensor := InitSds011(0xA160, false, conn, results, 7)
+	sensor.tPrevResultTime = time.Now().Add(-time.Hour) //Period based estimate would count data
+	sensor.WarmUp = WARMUP_DROP                         //Cycle returns result anyway, Run drops it
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+	if err := sensor.SyncSettingsFromDevice(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cycle := NewDutyCycle(&sensor, IntervalSchedule{Interval: 100 * time.Millisecond})
+	cycle.WarmUp = 10 * time.Millisecond
+	cycle.SampleInterval = time.Millisecond
+	res, errCycle := cycle.Cycle(ctx, time.Now())
+	if errCycle != nil {
+		t.Fatal(errCycle)
+	}
+	if res.MeasurementCounter != 8 || sensor.MeasurementCounter() != 8 {
+		t.Errorf("cycle counted %v, sensor counter %v. Expected 8", res.MeasurementCounter, sensor.MeasurementCounter())
+	}
+	if res.Quality != QUALITY_WARMINGUP {
+		t.Errorf("sampled inside WARMUPTIME but quality is %v", res.Quality)
+	}
+
+	go cycle.Run(ctx)
+	ctxWait, cancelWait := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancelWait()
+	select {
+	case res = <-results:
+		t.Errorf("warm-up result pushed with drop policy %#v", res)
+	case <-ctxWait.Done():
+	}
+}
+
+func TestDutyCycleActiveMode(t *testing.T) {
+	conn := newFakeSensorConn(0xA160)
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 10), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+	if err := sensor.SyncSettingsFromDevice(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cycle := NewDutyCycle(&sensor, IntervalSchedule{Interval: 100 * time.Millisecond})
+	if errRun := cycle.Run(ctx); errRun == nil || ctx.Err() != nil {
+		t.Errorf("duty cycle started in active mode, err=%v", errRun)
+	}
+}
+
+func TestDutyCycleSleepFails(t *testing.T) {
+	conn := newFakeSensorConn(0xA160)
+	conn.queryMode = true
+	conn.noSleep = true
+	results := make(chan Result, 10)
+	sensor := InitSds011(0xA160, false, conn, results, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+	if err := sensor.SyncSettingsFromDevice(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cycle := NewDutyCycle(&sensor, IntervalSchedule{Interval: 100 * time.Millisecond})
+	cycle.WarmUp = 10 * time.Millisecond
+	cycle.SampleInterval = time.Millisecond
+	go cycle.Run(ctx)
+
+	select {
+	case res := <-results:
+		if res.SmallReg != 100 || res.Slot.IsZero() {
+			t.Errorf("invalid average %#v", res)
+		}
+	case <-ctx.Done():
+		t.Fatalf("average dropped when sleep failed")
+	}
+	for {
+		select {
+		case err := <-sensor.ErrorsCh:
+			if errors.Is(err, ErrTimeout) {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatalf("sleep error not reported")
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Error values for checking with errors.Is and errors.As
+
+Supervisor can decide by these should it retry, reconnect or alert
+*/
+
+package sds011
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTimeout       = errors.New("timeout")                           //Sensor did not reply in time. Sleeping, unplugged or wrong ID
+	ErrChecksum      = errors.New("checksum error")                    //Line noise or bad wiring
+	ErrPassiveMode   = errors.New("write not allowed in passive mode") //Software error, passive sensor only listens
+	ErrPowerDisabled = errors.New("power line not enabled")            //Software error, query made while sensor is powered off
+	ErrInvalidPacket = errors.New("invalid packet")                    //Packet did not pass parsing
+	ErrEcho          = errors.New("command echoed back")               //Sensor side recieves commands. RX-TX short or RS485 echo
+	ErrDisconnected  = errors.New("disconnected")                      //Link is down, supervisor is trying to reconnect
+	ErrWriteBudget   = errors.New("write budget exceeded")             //Non-volatile write refused, see BudgetError
+	ErrNoData        = errors.New("no data")                           //Result overdue in active mode, see NoDataError
+)
+
+/*
+IsRecoverable tells is error caused by one bad frame (line noise, CRC, echo).
+Reading can continue after these. Other errors (device gone, EIO) are fatal for Run
+*/
+func IsRecoverable(err error) bool {
+	var frameErr *FrameError
+	return errors.As(err, &frameErr) || errors.Is(err, ErrChecksum) || errors.Is(err, ErrEcho) || errors.Is(err, ErrInvalidPacket)
+}
+
+// FrameError tells why bytes do not form valid packet
+type FrameError struct {
+	Offset int  //Byte index in frame where problem is
+	Size   bool //Frame length is wrong for command
+	Reason string
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("frame error at byte %v: %v", e.Offset, e.Reason)
+}
+
+// VerifyError is returned when sensor reply does not confirm written setting
+type VerifyError struct {
+	Setting string
+	Want    interface{}
+	Got     interface{}
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("setting %v to %v failed, sensor reported %v", e.Setting, e.Want, e.Got)
+}
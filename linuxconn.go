@@ -3,9 +3,7 @@
 package sds011
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -15,50 +13,10 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// Serial port on linux. Reading and sending is done by StreamConn
 type LinuxConn struct {
-	f         *os.File
-	serReader *bufio.Reader
-	buf       []byte //keep old here
-}
-
-func (p *LinuxConn) Close() error {
-	return p.f.Close()
-}
-
-func (p *LinuxConn) SendBytes(data []byte) error {
-	_, err := p.f.Write(data)
-	return err
-}
-
-func (p *LinuxConn) Send(packet Packet) error {
-	_, err := p.f.Write(packet.ToBytes())
-	return err
-}
-
-func (p *LinuxConn) Recieve() (*Packet, error) {
-	respbuf := make([]byte, 1024)
-
-	nRecieved, errRead := p.serReader.Read(respbuf)
-	if errRead != nil {
-		if errRead != io.EOF { //Something more bad than eof happend
-			return nil, fmt.Errorf("error reading err=%v", errRead.Error())
-		}
-	}
-	if nRecieved < 1 {
-		return nil, nil
-	}
-
-	//Do we have enough bytes
-	p.buf = append(p.buf, respbuf[0:nRecieved]...)
-	p.buf = trimToPacketStart(p.buf)
-	if !EnoughBytes(p.buf) {
-		return nil, nil
-	}
-
-	rxPack := Packet{}
-	parseErr := rxPack.FromBytes(GetUptime(), p.buf)
-	p.buf = p.buf[1:] //Remove start index even ok or invalid packet for clearing up for next
-	return &rxPack, parseErr
+	StreamConn
+	f *os.File
 }
 
 // Uses fixed settings for SDS0101
@@ -68,7 +26,7 @@ func CreateLinuxSerial(deviceportName string) (*LinuxConn, error) {
 	if !strings.HasPrefix(deviceportName, "/dev/pts") { //Avoid issues with testing with socat
 		portUsedByPids, _, errPortDetect := listserialports.FileIsInUseByPids(deviceportName)
 		if errPortDetect != nil {
-			return nil, fmt.Errorf("serial port error %v", errPortDetect.Error())
+			return nil, fmt.Errorf("serial port error %w", errPortDetect)
 		}
 		if 0 < len(portUsedByPids) {
 			return nil, fmt.Errorf("serial port %v is in use (by PID %#v)", deviceportName, portUsedByPids)
@@ -77,12 +35,13 @@ func CreateLinuxSerial(deviceportName string) (*LinuxConn, error) {
 
 	f, errOpen := os.OpenFile(deviceportName, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0666)
 	result := LinuxConn{
-		f:         f,
-		serReader: bufio.NewReader(f),
-		buf:       []byte{},
+		StreamConn: *NewStreamConn(f),
+		f:          f,
 	}
+	result.eofIsIdle = true
+	result.dec.Clock = GetUptime
 	if errOpen != nil {
-		return &result, fmt.Errorf("serial device %v open error %v", deviceportName, errOpen.Error())
+		return &result, fmt.Errorf("serial device %v open error %w", deviceportName, errOpen)
 	}
 
 	//No parity, one stop bit
@@ -107,12 +66,12 @@ func CreateLinuxSerial(deviceportName string) (*LinuxConn, error) {
 		0,
 		0,
 	); errno != 0 {
-		return &result, fmt.Errorf("syscall6 fail %v", errno.Error())
+		return &result, fmt.Errorf("syscall6 fail %w", errno)
 	}
 
 	errNonBlock := unix.SetNonblock(int(fd), false)
 	if errNonBlock != nil {
-		return &result, fmt.Errorf("setting nonblock %v", errNonBlock.Error())
+		return &result, fmt.Errorf("setting nonblock %w", errNonBlock)
 	}
 	return &result, nil
 }
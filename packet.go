@@ -5,6 +5,7 @@ For unpacking and packing SDS011 message packets
 package sds011
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"strings"
@@ -138,15 +139,13 @@ func (p *Packet) ToBytes() []byte {
 	return append(result, tail...)
 }
 
-// trims line noise away
+// trims line noise away. Starts from first header, payload can contain 0xAA
 func trimToPacketStart(input []byte) []byte {
-	result := []byte{}
-	for iStart, v := range input {
-		if v == SDS011PACKETSTART {
-			result = input[iStart:]
-		}
+	iStart := bytes.IndexByte(input, SDS011PACKETSTART)
+	if iStart < 0 {
+		return input[len(input):]
 	}
-	return result
+	return input[iStart:]
 }
 
 func EnoughBytes(arr []byte) bool {
@@ -170,7 +169,7 @@ func (p *Packet) FromBytes(uptimeNow int64, arr []byte) error {
 	arr = trimToPacketStart(arr)
 
 	if len(arr) < SDS011FROMSENSORSIZE {
-		return fmt.Errorf("invalid data size=%v at least %v requred", len(arr), SDS011FROMSENSORSIZE)
+		return &FrameError{Offset: len(arr), Size: true, Reason: fmt.Sprintf("size %v, at least %v required", len(arr), SDS011FROMSENSORSIZE)}
 	}
 	//Is larger packet? Check that first
 	if SDS011FROMSENSORSIZE <= len(arr) {
@@ -186,18 +185,18 @@ func (p *Packet) FromBytes(uptimeNow int64, arr []byte) error {
 	}
 
 	if (len(arr) != SDS011FROMSENSORSIZE) && (len(arr) != SDS011TOSENSORSIZE) {
-		return fmt.Errorf("invalid data size %v", len(arr))
+		return &FrameError{Offset: len(arr), Size: true, Reason: fmt.Sprintf("invalid size %v", len(arr))}
 	}
 	if arr[0] != 0xAA {
-		return fmt.Errorf("invalid packet header %X", arr[0])
+		return &FrameError{Offset: 0, Reason: fmt.Sprintf("invalid header %X", arr[0])}
 	}
 	if arr[len(arr)-1] != SDS011PACKETSTOP {
-		return fmt.Errorf("invalid packet termination %X", arr[len(arr)-1])
+		return &FrameError{Offset: len(arr) - 1, Reason: fmt.Sprintf("invalid termination %X", arr[len(arr)-1])}
 	}
 	p.CommandID = arr[1]
 
 	if p.CommandID != COMMANDID_CMD && p.CommandID != COMMANDID_RESPONSE && p.CommandID != COMMANDID_DATAREPLY {
-		return fmt.Errorf("command ID 0x%X is not supported", p.CommandID)
+		return &FrameError{Offset: 1, Reason: fmt.Sprintf("command ID 0x%X is not supported", p.CommandID)}
 	}
 
 	p.Checksum = arr[len(arr)-2]
@@ -208,39 +207,39 @@ func (p *Packet) FromBytes(uptimeNow int64, arr []byte) error {
 	switch p.CommandID {
 	case COMMANDID_CMD:
 		if len(arr) != 19 {
-			return fmt.Errorf("expect 19 long packet for commandID %v", COMMANDID_CMD)
+			return &FrameError{Offset: len(arr), Size: true, Reason: fmt.Sprintf("expect 19 long packet for commandID 0x%X", COMMANDID_CMD)}
 		}
 
 		switch p.Data[0] {
 		case FUNNUMBER_REPORTINGMODE, FUNNUMBER_QUERYDATA, FUNNUMBER_SETID, FUNNUMBER_SLEEPWORK, FUNNUMBER_PERIOD, FUNNUMBER_VERSION:
 			//OK
 		default:
-			return fmt.Errorf("function %v not supportd with commandID 0x%X", p.Data[0], p.CommandID)
+			return &FrameError{Offset: 2, Reason: fmt.Sprintf("function %v not supported with commandID 0x%X", p.Data[0], p.CommandID)}
 		}
 
 	case COMMANDID_RESPONSE:
 		if len(arr) != 10 {
-			return fmt.Errorf("expect 10 long packet for commandID %v", COMMANDID_RESPONSE)
+			return &FrameError{Offset: len(arr), Size: true, Reason: fmt.Sprintf("expect 10 long packet for commandID 0x%X", COMMANDID_RESPONSE)}
 		}
 		//LACKS: FUNNUMBER_QUERYDATA
 		switch p.Data[0] {
 		case FUNNUMBER_REPORTINGMODE, FUNNUMBER_SETID, FUNNUMBER_SLEEPWORK, FUNNUMBER_PERIOD, FUNNUMBER_VERSION:
 			//OK
 		default:
-			return fmt.Errorf("function %v not supportd with commandID 0x%X", p.Data[0], p.CommandID)
+			return &FrameError{Offset: 2, Reason: fmt.Sprintf("function %v not supported with commandID 0x%X", p.Data[0], p.CommandID)}
 		}
 
 	case COMMANDID_DATAREPLY:
 		if len(arr) != 10 {
-			return fmt.Errorf("expect 10 long packet for commandID %v", COMMANDID_DATAREPLY)
+			return &FrameError{Offset: len(arr), Size: true, Reason: fmt.Sprintf("expect 10 long packet for commandID 0x%X", COMMANDID_DATAREPLY)}
 		}
 
 	default:
-		return fmt.Errorf("invalid command id %v", p.CommandID)
+		return &FrameError{Offset: 1, Reason: fmt.Sprintf("invalid command id %v", p.CommandID)}
 	}
 
 	if !p.ChecksumOk() {
-		return fmt.Errorf("checksum error")
+		return fmt.Errorf("%w, got %X calculated %X", ErrChecksum, p.Checksum, p.CalcChecksum())
 	}
 	p.Valid = true
 	return nil
@@ -344,7 +343,7 @@ func millisecToString(ms int64) string {
 
 func (p *Packet) GetMeasurement() (Result, error) {
 	if !p.Valid {
-		return Result{}, fmt.Errorf("invalid packet")
+		return Result{}, ErrInvalidPacket
 	}
 	if p.CommandID != COMMANDID_DATAREPLY {
 		return Result{}, fmt.Errorf("not measurement packet commandid=%v", p.CommandID)
@@ -424,7 +423,7 @@ func (p *Packet) GetWorkMode() (bool, error) {
 
 func (p *Packet) checkFunctionNumberAndLen(fun byte, minlength int) error {
 	if !p.Valid {
-		return fmt.Errorf("invalid packet")
+		return ErrInvalidPacket
 	}
 	if len(p.Data) < minlength {
 		return fmt.Errorf("data length %v under %v", len(p.Data), minlength)
@@ -487,7 +486,7 @@ func NewPacket_QueryVersionReply(deviceId uint16, year byte, month byte, day byt
 
 func (p *Packet) GetVersionString() (string, error) {
 	if !p.Valid {
-		return "", fmt.Errorf("invalid packet")
+		return "", ErrInvalidPacket
 	}
 	if p.Data[0] != FUNNUMBER_VERSION {
 		return "", fmt.Errorf("function number is not %v, it is %v", FUNNUMBER_VERSION, p.Data[0])
@@ -2,6 +2,7 @@ package sds011
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -344,3 +345,26 @@ func TestPacketConversions(t *testing.T) {
 		}
 	}
 }
+
+func TestPacketParseErrors(t *testing.T) {
+	reply := NewPacket_DataReply(0xA160, 1236, 2618)
+	raw := reply.ToBytes()
+	raw[len(raw)-2]++ //Break checksum
+
+	var pack Packet
+	parseErr := pack.FromBytes(0, raw)
+	if !errors.Is(parseErr, ErrChecksum) {
+		t.Errorf("expected checksum error, got %v", parseErr)
+	}
+
+	raw = reply.ToBytes()
+	raw[1] = 0x12 //Unknown command ID
+	parseErr = pack.FromBytes(0, raw)
+	var frameErr *FrameError
+	if !errors.As(parseErr, &frameErr) {
+		t.Fatalf("expected frame error, got %v", parseErr)
+	}
+	if frameErr.Offset != 1 {
+		t.Errorf("invalid offset %v on frame error", frameErr.Offset)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+In memory Conn pair
+
+For running Sds011 and simulated sensor in same process without OS devices.
+Bytes can be delayed by latency and paced by baud rate (10 bits per byte, 8N1)
+*/
+
+package sds011
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type timedByte struct {
+	b        byte
+	tDeliver time.Time
+}
+
+// One direction of pipe
+type pipeDirection struct {
+	mu      sync.Mutex
+	queue   []timedByte
+	tLastTx time.Time //When previous byte is fully sent, for baud pacing
+	closed  bool
+	notify  chan struct{}
+
+	latency time.Duration
+	baud    int //0 is no pacing
+}
+
+func newPipeDirection() *pipeDirection {
+	return &pipeDirection{notify: make(chan struct{}, 1)}
+}
+
+func (p *pipeDirection) write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	tNow := time.Now()
+	for _, b := range data {
+		tSent := tNow
+		if 0 < p.baud {
+			if tSent.Before(p.tLastTx) { //Line busy
+				tSent = p.tLastTx
+			}
+			tSent = tSent.Add(time.Second * 10 / time.Duration(p.baud))
+		}
+		p.tLastTx = tSent
+		p.queue = append(p.queue, timedByte{b: b, tDeliver: tSent.Add(p.latency)})
+	}
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+	return len(data), nil
+}
+
+func (p *pipeDirection) read(b []byte, deadline time.Time) (int, error) {
+	for {
+		p.mu.Lock()
+		tNow := time.Now()
+		n := 0
+		for n < len(b) && n < len(p.queue) && !p.queue[n].tDeliver.After(tNow) {
+			b[n] = p.queue[n].b
+			n++
+		}
+		p.queue = p.queue[n:]
+		if 0 < n {
+			p.mu.Unlock()
+			return n, nil
+		}
+		if p.closed && len(p.queue) == 0 {
+			p.mu.Unlock()
+			return 0, io.EOF
+		}
+		wait := time.Hour
+		if 0 < len(p.queue) {
+			wait = p.queue[0].tDeliver.Sub(tNow)
+		}
+		p.mu.Unlock()
+
+		if !deadline.IsZero() {
+			untilDeadline := time.Until(deadline)
+			if untilDeadline <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			wait = min(wait, untilDeadline)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-p.notify:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (p *pipeDirection) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Implements io.ReadWriteCloser with read deadline
+type pipeEnd struct {
+	in, out  *pipeDirection
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (p *pipeEnd) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	deadline := p.deadline
+	p.mu.Unlock()
+	return p.in.read(b, deadline)
+}
+
+func (p *pipeEnd) Write(b []byte) (int, error) {
+	return p.out.write(b)
+}
+
+func (p *pipeEnd) Close() error {
+	p.in.close()
+	p.out.close()
+	return nil
+}
+
+func (p *pipeEnd) SetReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadline = t
+	return nil
+}
+
+// One end of in memory pipe. Implements Conn
+type PipeConn struct {
+	StreamConn
+	end *pipeEnd
+}
+
+// SetLatency delays bytes sent from this end. Set before use
+func (p *PipeConn) SetLatency(latency time.Duration) {
+	p.end.out.mu.Lock()
+	defer p.end.out.mu.Unlock()
+	p.end.out.latency = latency
+}
+
+// SetBaud paces bytes sent from this end like serial line. 0 is no pacing
+func (p *PipeConn) SetBaud(baud int) {
+	p.end.out.mu.Lock()
+	defer p.end.out.mu.Unlock()
+	p.end.out.baud = baud
+}
+
+// NewPipeConnPair returns two connected ends. Closing one end closes both directions
+func NewPipeConnPair() (*PipeConn, *PipeConn) {
+	aToB := newPipeDirection()
+	bToA := newPipeDirection()
+	endA := &pipeEnd{in: bToA, out: aToB}
+	endB := &pipeEnd{in: aToB, out: bToA}
+	return &PipeConn{StreamConn: *NewStreamConn(endA), end: endA}, &PipeConn{StreamConn: *NewStreamConn(endB), end: endB}
+}
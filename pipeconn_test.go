@@ -0,0 +1,53 @@
+package sds011
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPipeConnPair(t *testing.T) {
+	hostEnd, sensorEnd := NewPipeConnPair()
+	for _, end := range []*PipeConn{hostEnd, sensorEnd} {
+		end.SetBaud(9600)
+		end.SetLatency(20 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	sensorErr := make(chan error, 1)
+	go func() { //Sensor side
+		for ctx.Err() == nil {
+			query, err := sensorEnd.Recieve()
+			if err != nil && !IsRecoverable(err) {
+				sensorErr <- err
+				return
+			}
+			if query != nil && query.Data[0] == FUNNUMBER_QUERYDATA {
+				sensorEnd.Send(NewPacket_DataReply(query.DeviceID, 1, 2))
+			}
+		}
+	}()
+
+	sensor := InitSds011(0xA160, false, hostEnd, make(chan Result, 3), 0)
+	go sensor.Run(ctx)
+	tStart := time.Now()
+	res, errQuery := sensor.QueryMeasurement(ctx)
+	if errQuery != nil {
+		t.Fatal(errQuery)
+	}
+	if res.SmallReg != 1 || res.LargeReg != 2 {
+		t.Errorf("invalid result %#v", res)
+	}
+	//Latency both ways and 29 bytes at 9600 baud
+	if roundTrip := time.Since(tStart); roundTrip < 70*time.Millisecond {
+		t.Errorf("round trip %v is faster than line", roundTrip)
+	}
+
+	hostEnd.Close()
+	select {
+	case <-sensorErr:
+	case <-ctx.Done():
+		t.Errorf("peer close not noticed")
+	}
+}
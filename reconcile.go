@@ -0,0 +1,145 @@
+/*
+Reconciler keeps sensor settings in desired state. Opt-in
+
+Settings are read from sensor periodically and rewritten only if sensor have drifted (power cycle, someone else configured it).
+Period and query mode are non-volatile, so corrective writes are rate limited for avoiding flash wearout.
+Each check is two request/reply pairs on the line (query mode and period, version is not read). On shared RS485 bus
+those hold bus and delay other sensors, so keep Interval in minutes
+*/
+
+package sds011
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	RECONCILEMINWRITEINTERVAL = 600000 //milliseconds, minimum time between corrective writes
+	RECONCILEINTERVAL         = 300000 //milliseconds, default time between settings checks
+)
+
+// Correction is reported each time drift is found
+type Correction struct {
+	Setting  string
+	Want     interface{}
+	Got      interface{} //What was on sensor
+	Time     time.Time
+	Deferred bool  //Not written because of rate limit or write budget. Tried again on later check
+	Err      error //Write failed
+}
+
+func (p Correction) String() string {
+	if p.Deferred {
+		return fmt.Sprintf("%v drifted to %v (want %v), write deferred", p.Setting, p.Got, p.Want)
+	}
+	if p.Err != nil {
+		return fmt.Sprintf("%v drifted to %v (want %v), write failed %v", p.Setting, p.Got, p.Want, p.Err)
+	}
+	return fmt.Sprintf("%v corrected from %v to %v", p.Setting, p.Got, p.Want)
+}
+
+type Reconciler struct {
+	Desired          Sds011Settings
+	Interval         time.Duration //How often settings are read from sensor
+	MinWriteInterval time.Duration
+	Corrections      chan Correction //Not pushed if full
+
+	sensor     *Sds011
+	tLastWrite time.Time
+}
+
+func NewReconciler(sensor *Sds011, desired Sds011Settings) *Reconciler {
+	return &Reconciler{
+		Desired:          desired,
+		Interval:         time.Millisecond * RECONCILEINTERVAL,
+		MinWriteInterval: time.Millisecond * RECONCILEMINWRITEINTERVAL,
+		Corrections:      make(chan Correction, 10),
+		sensor:           sensor,
+	}
+}
+
+func (p *Reconciler) report(correction Correction) {
+	select {
+	case p.Corrections <- correction:
+	default:
+	}
+}
+
+/*
+Check reads settings from sensor once and writes only drifted ones.
+Read error is returned (sensor offline, sleeping etc..)
+*/
+func (p *Reconciler) Check(ctx context.Context) error {
+	if p.sensor.PassiveMode {
+		return ErrPassiveMode
+	}
+	if 30 < p.Desired.Period {
+		return fmt.Errorf("invalid period %v", p.Desired.Period)
+	}
+
+	onSensor, errRead := p.sensor.readStoredSettings(ctx)
+	if errRead != nil {
+		return errRead
+	}
+
+	writeAllowed := p.tLastWrite.IsZero() || p.MinWriteInterval <= time.Since(p.tLastWrite)
+	wrote := false
+	if onSensor.Period != p.Desired.Period {
+		correction := Correction{Setting: "period", Want: p.Desired.Period, Got: onSensor.Period, Time: time.Now(), Deferred: !writeAllowed}
+		if writeAllowed {
+			correction.Err = p.sensor.writePeriod(ctx, p.Desired.Period)
+			wrote = true
+			if correction.Err == nil {
+				onSensor.Period = p.Desired.Period
+			}
+			correction.Deferred = errors.Is(correction.Err, ErrWriteBudget)
+		}
+		p.report(correction)
+	}
+	if onSensor.QueryMode != p.Desired.QueryMode {
+		correction := Correction{Setting: "query mode", Want: p.Desired.QueryMode, Got: onSensor.QueryMode, Time: time.Now(), Deferred: !writeAllowed}
+		if writeAllowed {
+			correction.Err = p.sensor.writeQueryMode(ctx, p.Desired.QueryMode)
+			wrote = true
+			if correction.Err == nil {
+				onSensor.QueryMode = p.Desired.QueryMode
+			}
+			correction.Deferred = errors.Is(correction.Err, ErrWriteBudget)
+		}
+		p.report(correction)
+	}
+	if wrote {
+		p.tLastWrite = time.Now()
+	}
+	p.sensor.updateSettings(onSensor)
+	return nil
+}
+
+/*
+Run checks settings every Interval until ctx is done. Sensor Run must be running.
+Read errors are reported on sensor ErrorsCh
+*/
+func (p *Reconciler) Run(ctx context.Context) error {
+	if p.sensor.PassiveMode {
+		return ErrPassiveMode
+	}
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		errCheck := p.Check(ctx)
+		if errCheck != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			p.sensor.reportError(fmt.Errorf("settings check failed %w", errCheck))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
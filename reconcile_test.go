@@ -0,0 +1,135 @@
+package sds011
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Replies to commands like real sensor would. Counts non-volatile writes
+type fakeSensorConn struct {
+	mu        sync.Mutex
+	id        uint16
+	queryMode bool
+	period    byte
+	working   bool
+	writes    int
+	versions  int  //Version queries
+	noSleep   bool //Does not reply to sleep command
+	replies   chan Packet
+}
+
+func newFakeSensorConn(id uint16) *fakeSensorConn {
+	return &fakeSensorConn{id: id, working: true, replies: make(chan Packet, 10)}
+}
+
+func (p *fakeSensorConn) Send(packet Packet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	write := packet.GetIsWrite()
+	switch packet.Data[0] {
+	case FUNNUMBER_REPORTINGMODE:
+		if write {
+			p.queryMode, _ = packet.GetQueryMode()
+			p.writes++
+		}
+		p.replies <- NewPacket_SetQueryModeReply(p.id, write, p.queryMode)
+	case FUNNUMBER_PERIOD:
+		if write {
+			p.period, _ = packet.GetPeriod()
+			p.writes++
+		}
+		p.replies <- NewPacket_SetPeriodReply(p.id, write, p.period)
+	case FUNNUMBER_SLEEPWORK:
+		if write {
+			working, _ := packet.GetWorkMode()
+			if p.noSleep && !working {
+				return nil
+			}
+			p.working = working
+		}
+		p.replies <- NewPacket_SetWorkModeReply(p.id, write, p.working)
+	case FUNNUMBER_VERSION:
+		p.versions++
+		p.replies <- NewPacket_QueryVersionReply(p.id, 19, 9, 28)
+	case FUNNUMBER_QUERYDATA:
+		if p.working {
+			p.replies <- NewPacket_DataReply(p.id, 100, 200)
+		}
+	}
+	return nil
+}
+
+func (p *fakeSensorConn) Recieve() (*Packet, error) {
+	select {
+	case pack := <-p.replies:
+		return &pack, nil
+	case <-time.After(10 * time.Millisecond):
+		return nil, nil
+	}
+}
+
+func (p *fakeSensorConn) Close() error {
+	return nil
+}
+
+func (p *fakeSensorConn) drift(period byte) {
+	p.mu.Lock()
+	p.period = period
+	p.mu.Unlock()
+}
+
+func (p *fakeSensorConn) writeCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writes
+}
+
+func TestReconcilerWritesOnlyOnDrift(t *testing.T) {
+	conn := newFakeSensorConn(0xA160)
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 3), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	reconciler := NewReconciler(&sensor, Sds011Settings{QueryMode: true, Period: 2})
+	reconciler.MinWriteInterval = time.Hour
+	if reconciler.Interval < time.Minute {
+		t.Errorf("default interval %v floods bus", reconciler.Interval)
+	}
+
+	if errCheck := reconciler.Check(ctx); errCheck != nil {
+		t.Fatalf("check failed %v", errCheck)
+	}
+	if conn.writeCount() != 2 {
+		t.Errorf("expected 2 writes, got %v", conn.writeCount())
+	}
+
+	if errCheck := reconciler.Check(ctx); errCheck != nil {
+		t.Fatalf("check failed %v", errCheck)
+	}
+	if conn.writeCount() != 2 {
+		t.Errorf("no drift, but wrote. %v writes", conn.writeCount())
+	}
+
+	conn.drift(0) //Like someone else configured sensor
+	for 0 < len(reconciler.Corrections) {
+		<-reconciler.Corrections
+	}
+	if errCheck := reconciler.Check(ctx); errCheck != nil {
+		t.Fatalf("check failed %v", errCheck)
+	}
+	if conn.writeCount() != 2 {
+		t.Errorf("rate limit did not work, %v writes", conn.writeCount())
+	}
+	correction := <-reconciler.Corrections
+	if !correction.Deferred || correction.Setting != "period" {
+		t.Errorf("expected deferred period correction, got %s", correction)
+	}
+	conn.mu.Lock()
+	if conn.versions != 0 {
+		t.Errorf("reconciler read version %v times", conn.versions)
+	}
+	conn.mu.Unlock()
+}
@@ -0,0 +1,192 @@
+/*
+ReconnectConn keeps link open. For links that can go away, like USB-serial adapters and network gateways
+
+When link fails, it is closed and opened again with exponential backoff. Recieve does not return error for that.
+Connect and disconnect events are reported on Events channel. SerialSupervisor and TCPConn are ReconnectConns with own open function
+*/
+
+package sds011
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	RECONNECTPOLL = 100 //milliseconds, Recieve sleeps max this while waiting next reconnect try
+)
+
+type LinkEvent struct {
+	Connected bool
+	Port      string //Device file or address
+	Err       error  //Why disconnected or why connecting failed. On connected event: error from OnConnect
+	Time      time.Time
+}
+
+func (p LinkEvent) String() string {
+	if p.Connected {
+		if p.Err != nil {
+			return fmt.Sprintf("connected %v, on connect failed %v", p.Port, p.Err)
+		}
+		return fmt.Sprintf("connected %v", p.Port)
+	}
+	return fmt.Sprintf("disconnected %v: %v", p.Port, p.Err)
+}
+
+// Opens link. Port tells what was opened (or tried), it is reported in LinkEvent
+type OpenFunc func() (conn Conn, port string, err error)
+
+// Implements Conn. Never returns error from Recieve, unless closed
+type ReconnectConn struct {
+	Backoff Backoff //Change before use if needed
+	Events  chan LinkEvent
+
+	//Called on own goroutine after each connect. Like re-applying sensor settings. Sensor Run must be running for that
+	OnConnect func() error
+
+	open     OpenFunc
+	mu       sync.Mutex
+	conn     Conn
+	port     string
+	closed   bool
+	tNextTry time.Time
+}
+
+func NewReconnectConn(open OpenFunc) *ReconnectConn {
+	return &ReconnectConn{
+		Backoff: DefaultBackoff(),
+		Events:  make(chan LinkEvent, 10),
+		open:    open,
+	}
+}
+
+func (p *ReconnectConn) reportEvent(event LinkEvent) {
+	select {
+	case p.Events <- event:
+	default:
+	}
+}
+
+// Must hold mutex
+func (p *ReconnectConn) disconnect(reason error) {
+	if p.conn == nil {
+		return
+	}
+	p.conn.Close()
+	p.conn = nil
+	p.tNextTry = time.Now().Add(p.Backoff.Next())
+	p.reportEvent(LinkEvent{Connected: false, Port: p.port, Err: reason, Time: time.Now()})
+}
+
+// Must hold mutex. Takes already opened link in use, without event
+func (p *ReconnectConn) setConnLocked(conn Conn, port string) {
+	p.conn = conn
+	p.port = port
+	p.Backoff.Reset()
+}
+
+// Must hold mutex. Returns nil if not connected and not yet time to try
+func (p *ReconnectConn) ensureConn() (Conn, error) {
+	if p.closed {
+		return nil, os.ErrClosed
+	}
+	if p.conn != nil || time.Now().Before(p.tNextTry) {
+		return p.conn, nil
+	}
+
+	conn, port, errOpen := p.open()
+	if errOpen != nil {
+		p.tNextTry = time.Now().Add(p.Backoff.Next())
+		p.reportEvent(LinkEvent{Connected: false, Port: port, Err: errOpen, Time: time.Now()})
+		return nil, nil
+	}
+	p.setConnLocked(conn, port)
+
+	onConnect := p.OnConnect
+	if onConnect == nil {
+		p.reportEvent(LinkEvent{Connected: true, Port: port, Time: time.Now()})
+	} else {
+		go func() {
+			errOnConnect := onConnect()
+			p.reportEvent(LinkEvent{Connected: true, Port: port, Err: errOnConnect, Time: time.Now()})
+		}()
+	}
+	return conn, nil
+}
+
+// Connected tells is link up now
+func (p *ReconnectConn) Connected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn != nil
+}
+
+// Stats of current link. Counting starts again after reconnect
+func (p *ReconnectConn) Stats() LinkStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	withStats, ok := p.conn.(interface{ Stats() LinkStats })
+	if !ok {
+		return newLinkCounters().snapshot()
+	}
+	return withStats.Stats()
+}
+
+func (p *ReconnectConn) Send(packet Packet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn, errConn := p.ensureConn()
+	if errConn != nil {
+		return errConn
+	}
+	if conn == nil {
+		return ErrDisconnected
+	}
+	errSend := conn.Send(packet)
+	if errSend != nil {
+		p.disconnect(errSend)
+	}
+	return errSend
+}
+
+func (p *ReconnectConn) Recieve() (*Packet, error) {
+	p.mu.Lock()
+	conn, errConn := p.ensureConn()
+	if errConn != nil {
+		p.mu.Unlock()
+		return nil, errConn
+	}
+	if conn == nil {
+		wait := time.Until(p.tNextTry)
+		p.mu.Unlock()
+		time.Sleep(min(wait, time.Millisecond*RECONNECTPOLL))
+		return nil, nil
+	}
+	p.mu.Unlock()
+
+	pack, errRecv := conn.Recieve()
+	if errRecv != nil && !IsRecoverable(errRecv) {
+		p.mu.Lock()
+		if p.conn == conn {
+			p.disconnect(errRecv)
+		}
+		p.mu.Unlock()
+		return nil, nil
+	}
+	return pack, errRecv
+}
+
+// Close closes link and stops reconnecting
+func (p *ReconnectConn) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.conn == nil {
+		return nil
+	}
+	errClose := p.conn.Close()
+	p.conn = nil
+	return errClose
+}
@@ -1,12 +1,19 @@
 package sds011
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type Result struct {
 	MeasurementCounter int
 	Uptime             int64
 	SmallReg           uint16
 	LargeReg           uint16
+	Wear               WearStatus    //Zero if WearTracker is not in use
+	Quality            ResultQuality //Readings right after wake up are not reliable
+	Time               time.Time     //When recieved
+	Slot               time.Time     //Scheduled slot time. Zero if not from DutyCycle
 }
 
 func (p *Result) Small() float64 {
@@ -18,5 +25,9 @@ func (p *Result) Large() float64 {
 
 // NOTICE: non calibrated values, used for debug
 func (p *Result) ToString() string {
-	return fmt.Sprintf("count=%v %v PM2.5= %.1fµm/m³ PM10= %.1fµm/m³", p.MeasurementCounter, millisecToString(p.Uptime), p.Small(), p.Large())
+	qualityString := ""
+	if p.Quality != QUALITY_STABLE {
+		qualityString = fmt.Sprintf(" (%v)", p.Quality)
+	}
+	return fmt.Sprintf("count=%v %v PM2.5= %.1fµm/m³ PM10= %.1fµm/m³%v", p.MeasurementCounter, millisecToString(p.Uptime), p.Small(), p.Large(), qualityString)
 }
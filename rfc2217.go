@@ -0,0 +1,325 @@
+//go:build !tinygo
+
+/*
+RFC 2217 Telnet COM port client
+
+Telnet options are negotiated and remote port is set to 9600 8N1 without flow control, like CreateLinuxSerial does locally.
+0xFF bytes in SDS011 stream are escaped as IAC IAC. Otherwise works like LinuxConn
+*/
+
+package sds011
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	RFC2217NEGOTIATIONTIMEOUT = 3000 //milliseconds, server must confirm port settings in this time
+	RFC2217BAUDRATE           = 9600
+)
+
+// Telnet commands and options
+const (
+	TELNET_SE   = 240
+	TELNET_SB   = 250
+	TELNET_WILL = 251
+	TELNET_WONT = 252
+	TELNET_DO   = 253
+	TELNET_DONT = 254
+	TELNET_IAC  = 255
+
+	TELNETOPT_BINARY  = 0
+	TELNETOPT_SGA     = 3 //Suppress go ahead
+	TELNETOPT_COMPORT = 44
+)
+
+// COM port option commands from client. Server replies with command + COMPORT_SERVEROFFSET
+const (
+	COMPORT_SETBAUDRATE  = 1
+	COMPORT_SETDATASIZE  = 2
+	COMPORT_SETPARITY    = 3
+	COMPORT_SETSTOPSIZE  = 4
+	COMPORT_SETCONTROL   = 5
+	COMPORT_SERVEROFFSET = 100
+
+	//Sent by server any time, without request
+	COMPORT_NOTIFYLINESTATE  = 106
+	COMPORT_NOTIFYMODEMSTATE = 107
+
+	COMPORT_PARITYNONE   = 1
+	COMPORT_STOPSIZE1    = 1
+	COMPORT_CONTROLNONE  = 1 //No flow control
+	COMPORT_DATASIZE8BIT = 8
+)
+
+const (
+	telnetData = iota
+	telnetIAC
+	telnetOption //After DO, DONT, WILL or WONT
+	telnetSB
+	telnetSBIAC
+)
+
+// Strips telnet commands from read data and escapes written data. Implements io.ReadWriteCloser
+type telnetStream struct {
+	c net.Conn
+
+	raw       [256]byte
+	pending   []byte //Decoded data not yet read
+	dataBuf   [256]byte
+	state     int
+	optionCmd byte
+	sb        []byte
+
+	//Called from parse. Client side handlers by default, test server uses own
+	onOption         func(cmd byte, opt byte)
+	onSubnegotiation func(sb []byte)
+
+	mu      sync.Mutex      //Guards writes and replies
+	refused error           //Server refused option that client needs
+	replies map[byte][]byte //COM port server replies by client command
+}
+
+func newTelnetStream(c net.Conn) *telnetStream {
+	result := &telnetStream{c: c, replies: make(map[byte][]byte)}
+	result.onOption = result.option
+	result.onSubnegotiation = result.subnegotiation
+	return result
+}
+
+func (p *telnetStream) writeRaw(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.c.Write(data)
+	return err
+}
+
+func (p *telnetStream) Write(data []byte) (int, error) {
+	escaped := make([]byte, 0, len(data)+4)
+	for _, b := range data {
+		escaped = append(escaped, b)
+		if b == TELNET_IAC {
+			escaped = append(escaped, TELNET_IAC)
+		}
+	}
+	return len(data), p.writeRaw(escaped)
+}
+
+func (p *telnetStream) Close() error {
+	return p.c.Close()
+}
+
+func (p *telnetStream) SetReadDeadline(t time.Time) error {
+	return p.c.SetReadDeadline(t)
+}
+
+// Option request from server. Only options that client wants are accepted
+func (p *telnetStream) option(cmd byte, opt byte) {
+	switch cmd {
+	case TELNET_DO:
+		switch opt {
+		case TELNETOPT_COMPORT, TELNETOPT_BINARY: //Accepted what client offered
+		default:
+			p.writeRaw([]byte{TELNET_IAC, TELNET_WONT, opt})
+		}
+	case TELNET_DONT:
+		if opt == TELNETOPT_COMPORT || opt == TELNETOPT_BINARY {
+			p.refuse(fmt.Errorf("server refused option %v (DONT)", opt))
+		}
+	case TELNET_WILL:
+		if opt != TELNETOPT_BINARY && opt != TELNETOPT_SGA {
+			p.writeRaw([]byte{TELNET_IAC, TELNET_DONT, opt})
+		}
+	case TELNET_WONT:
+		if opt == TELNETOPT_BINARY { //Without binary mode server may mangle CR and NUL bytes
+			p.refuse(fmt.Errorf("server refused option %v (WONT)", opt))
+		}
+	}
+}
+
+// First refusal is kept
+func (p *telnetStream) refuse(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refused == nil {
+		p.refused = err
+	}
+}
+
+// Keeps replies to port setting commands. Notifications and other server messages are ignored
+func (p *telnetStream) subnegotiation(sb []byte) {
+	if len(sb) < 2 || sb[0] != TELNETOPT_COMPORT || sb[1] < COMPORT_SERVEROFFSET+COMPORT_SETBAUDRATE || COMPORT_SERVEROFFSET+COMPORT_SETCONTROL < sb[1] {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replies[sb[1]-COMPORT_SERVEROFFSET] = append([]byte(nil), sb[2:]...)
+}
+
+// Parses raw bytes, data goes to pending
+func (p *telnetStream) parse(raw []byte) {
+	data := p.dataBuf[:0]
+	for _, b := range raw {
+		switch p.state {
+		case telnetData:
+			if b == TELNET_IAC {
+				p.state = telnetIAC
+			} else {
+				data = append(data, b)
+			}
+		case telnetIAC:
+			p.state = telnetData
+			switch b {
+			case TELNET_IAC:
+				data = append(data, b)
+			case TELNET_DO, TELNET_DONT, TELNET_WILL, TELNET_WONT:
+				p.optionCmd = b
+				p.state = telnetOption
+			case TELNET_SB:
+				p.sb = p.sb[:0]
+				p.state = telnetSB
+			}
+		case telnetOption:
+			p.onOption(p.optionCmd, b)
+			p.state = telnetData
+		case telnetSB:
+			if b == TELNET_IAC {
+				p.state = telnetSBIAC
+			} else {
+				p.sb = append(p.sb, b)
+			}
+		case telnetSBIAC:
+			switch b {
+			case TELNET_SE:
+				p.onSubnegotiation(p.sb)
+				p.state = telnetData
+			case TELNET_IAC:
+				p.sb = append(p.sb, b)
+				p.state = telnetSB
+			default:
+				p.state = telnetData
+			}
+		}
+	}
+	p.pending = data
+}
+
+// Read returns 0 bytes without error if only telnet commands were recieved
+func (p *telnetStream) Read(b []byte) (int, error) {
+	if len(p.pending) == 0 {
+		n, errRead := p.c.Read(p.raw[:])
+		p.parse(p.raw[:n])
+		if len(p.pending) == 0 {
+			return 0, errRead
+		}
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func comPortCommand(command byte, value []byte) []byte {
+	result := []byte{TELNET_IAC, TELNET_SB, TELNETOPT_COMPORT, command}
+	for _, b := range value {
+		result = append(result, b)
+		if b == TELNET_IAC {
+			result = append(result, TELNET_IAC)
+		}
+	}
+	return append(result, TELNET_IAC, TELNET_SE)
+}
+
+// Server must confirm port settings (9600 8N1) with same values. Flow control reply is not checked, servers answer it differently
+func (p *telnetStream) checkReplies(settings map[byte][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, command := range []byte{COMPORT_SETBAUDRATE, COMPORT_SETDATASIZE, COMPORT_SETPARITY, COMPORT_SETSTOPSIZE} {
+		if !bytes.Equal(p.replies[command], settings[command]) {
+			return fmt.Errorf("server did not confirm com port command %v value %X, reply %X", command, settings[command], p.replies[command])
+		}
+	}
+	return nil
+}
+
+// Implements Conn
+type RFC2217Conn struct {
+	StreamConn
+}
+
+/*
+CreateRFC2217Conn connects to RFC 2217 server ("host:port") and sets remote port to 9600 8N1.
+Returns error if server does not confirm settings
+*/
+func CreateRFC2217Conn(addr string) (*RFC2217Conn, error) {
+	c, errDial := net.DialTimeout("tcp", addr, time.Millisecond*TCPDIALTIMEOUT)
+	if errDial != nil {
+		return nil, errDial
+	}
+	ts := newTelnetStream(c)
+
+	baud := make([]byte, 4)
+	binary.BigEndian.PutUint32(baud, RFC2217BAUDRATE)
+	settings := map[byte][]byte{
+		COMPORT_SETBAUDRATE: baud,
+		COMPORT_SETDATASIZE: {COMPORT_DATASIZE8BIT},
+		COMPORT_SETPARITY:   {COMPORT_PARITYNONE},
+		COMPORT_SETSTOPSIZE: {COMPORT_STOPSIZE1},
+		COMPORT_SETCONTROL:  {COMPORT_CONTROLNONE},
+	}
+	negotiation := []byte{
+		TELNET_IAC, TELNET_WILL, TELNETOPT_COMPORT,
+		TELNET_IAC, TELNET_WILL, TELNETOPT_BINARY,
+		TELNET_IAC, TELNET_DO, TELNETOPT_BINARY,
+		TELNET_IAC, TELNET_DO, TELNETOPT_SGA,
+	}
+	for command := byte(COMPORT_SETBAUDRATE); command <= COMPORT_SETCONTROL; command++ {
+		negotiation = append(negotiation, comPortCommand(command, settings[command])...)
+	}
+	errWrite := ts.writeRaw(negotiation)
+	if errWrite != nil {
+		c.Close()
+		return nil, errWrite
+	}
+
+	//Wait confirmations. Data recieved meanwhile stays pending
+	tEnd := time.Now().Add(time.Millisecond * RFC2217NEGOTIATIONTIMEOUT)
+	c.SetReadDeadline(tEnd)
+	for {
+		ts.mu.Lock()
+		refused := ts.refused
+		allReplied := true
+		for command := range settings {
+			_, found := ts.replies[command]
+			allReplied = allReplied && found
+		}
+		ts.mu.Unlock()
+		if refused != nil {
+			c.Close()
+			return nil, fmt.Errorf("%v: %w", addr, refused)
+		}
+		if allReplied {
+			errSettings := ts.checkReplies(settings)
+			if errSettings != nil {
+				c.Close()
+				return nil, fmt.Errorf("%v: %w", addr, errSettings)
+			}
+			break
+		}
+		n, errRead := c.Read(ts.raw[:])
+		pending := append([]byte(nil), ts.pending...)
+		ts.parse(ts.raw[:n])
+		ts.pending = append(pending, ts.pending...)
+		if errRead != nil {
+			c.Close()
+			return nil, fmt.Errorf("com port negotiation with %v failed %w", addr, errRead)
+		}
+	}
+	c.SetReadDeadline(time.Time{})
+
+	return &RFC2217Conn{StreamConn: *NewStreamConn(ts)}, nil
+}
@@ -0,0 +1,174 @@
+//go:build !tinygo
+
+package sds011
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Minimal RFC 2217 server with fake sensor behind it. Replies data queries
+type rfc2217TestServer struct {
+	ln            net.Listener
+	refuseComPort bool
+	refuseBinary  bool            //Answers WONT BINARY
+	replyOverride map[byte][]byte //Server confirms these values instead of what was set
+	notify        bool            //Sends line and modem state notifications before each confirmation
+
+	mu       sync.Mutex
+	settings map[byte][]byte //What client set
+}
+
+func (p *rfc2217TestServer) serve() {
+	for {
+		c, errAccept := p.ln.Accept()
+		if errAccept != nil {
+			return
+		}
+		go p.serveConn(c)
+	}
+}
+
+// Uses same telnet parser as client, with server side handlers
+func (p *rfc2217TestServer) serveConn(c net.Conn) {
+	defer c.Close()
+	ts := &telnetStream{c: c}
+	ts.onOption = func(cmd byte, opt byte) {
+		switch {
+		case cmd == TELNET_WILL && opt == TELNETOPT_COMPORT && p.refuseComPort:
+			ts.writeRaw([]byte{TELNET_IAC, TELNET_DONT, opt})
+		case cmd == TELNET_DO && opt == TELNETOPT_BINARY && p.refuseBinary:
+			ts.writeRaw([]byte{TELNET_IAC, TELNET_WONT, opt})
+		case cmd == TELNET_WILL:
+			ts.writeRaw([]byte{TELNET_IAC, TELNET_DO, opt})
+		case cmd == TELNET_DO:
+			ts.writeRaw([]byte{TELNET_IAC, TELNET_WILL, opt})
+		}
+	}
+	ts.onSubnegotiation = func(sb []byte) {
+		if len(sb) < 2 || sb[0] != TELNETOPT_COMPORT || p.refuseComPort {
+			return
+		}
+		value := append([]byte(nil), sb[2:]...)
+		p.mu.Lock()
+		p.settings[sb[1]] = value
+		p.mu.Unlock()
+		if override, found := p.replyOverride[sb[1]]; found {
+			value = override
+		}
+		if p.notify {
+			ts.writeRaw(comPortCommand(COMPORT_NOTIFYLINESTATE, []byte{0x60}))
+			ts.writeRaw(comPortCommand(COMPORT_NOTIFYMODEMSTATE, []byte{0xB0}))
+		}
+		ts.writeRaw(comPortCommand(sb[1]+COMPORT_SERVEROFFSET, value))
+	}
+
+	toSensor, fromClient := io.Pipe()
+	defer fromClient.Close()
+	go func() { //Fake sensor
+		dec := NewDecoder(toSensor)
+		for {
+			query := Packet{}
+			found, err := dec.Decode(&query)
+			if err != nil && !IsRecoverable(err) {
+				return
+			}
+			if found && query.Data[0] == FUNNUMBER_QUERYDATA {
+				reply := NewPacket_DataReply(query.DeviceID, 0xFF, 0xFFFF)
+				ts.Write(reply.ToBytes())
+			}
+		}
+	}()
+
+	buf := make([]byte, 256)
+	for {
+		n, errRead := ts.Read(buf)
+		if 0 < n {
+			fromClient.Write(buf[:n])
+		}
+		if errRead != nil {
+			return
+		}
+	}
+}
+
+func startRFC2217TestServer(t *testing.T, setup func(server *rfc2217TestServer)) *rfc2217TestServer {
+	ln, errListen := net.Listen("tcp", "127.0.0.1:0")
+	if errListen != nil {
+		t.Skipf("no local listener %v", errListen)
+	}
+	server := &rfc2217TestServer{ln: ln, settings: make(map[byte][]byte)}
+	if setup != nil {
+		setup(server)
+	}
+	go server.serve()
+	t.Cleanup(func() { ln.Close() })
+	return server
+}
+
+func TestRFC2217Conn(t *testing.T) {
+	server := startRFC2217TestServer(t, nil)
+	conn, errCreate := CreateRFC2217Conn(server.ln.Addr().String())
+	if errCreate != nil {
+		t.Fatal(errCreate)
+	}
+	defer conn.Close()
+
+	server.mu.Lock()
+	baud := binary.BigEndian.Uint32(server.settings[COMPORT_SETBAUDRATE])
+	parity := server.settings[COMPORT_SETPARITY]
+	server.mu.Unlock()
+	if baud != 9600 || len(parity) != 1 || parity[0] != COMPORT_PARITYNONE {
+		t.Errorf("remote port set to %v parity %v", baud, parity)
+	}
+
+	sensor := InitSds011(0xA1FF, false, conn, make(chan Result, 3), 0) //0xFF in ID must be escaped
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	res, errQuery := sensor.QueryMeasurement(ctx)
+	if errQuery != nil {
+		t.Fatal(errQuery)
+	}
+	if res.SmallReg != 0xFF || res.LargeReg != 0xFFFF {
+		t.Errorf("invalid result %#v", res)
+	}
+}
+
+func TestRFC2217Refused(t *testing.T) {
+	setups := map[string]func(server *rfc2217TestServer){
+		"com port":  func(server *rfc2217TestServer) { server.refuseComPort = true },
+		"binary":    func(server *rfc2217TestServer) { server.refuseBinary = true },
+		"data size": func(server *rfc2217TestServer) { server.replyOverride = map[byte][]byte{COMPORT_SETDATASIZE: {7}} },
+		"parity":    func(server *rfc2217TestServer) { server.replyOverride = map[byte][]byte{COMPORT_SETPARITY: {2}} },
+		"stop size": func(server *rfc2217TestServer) { server.replyOverride = map[byte][]byte{COMPORT_SETSTOPSIZE: {2}} },
+	}
+	for name, setup := range setups {
+		server := startRFC2217TestServer(t, setup)
+		conn, errCreate := CreateRFC2217Conn(server.ln.Addr().String())
+		if errCreate == nil {
+			conn.Close()
+			t.Errorf("%v refusal not noticed", name)
+		}
+	}
+}
+
+// Real servers send line and modem state at any time. Those are not replies to port settings
+func TestRFC2217Notifications(t *testing.T) {
+	server := startRFC2217TestServer(t, func(server *rfc2217TestServer) { server.notify = true })
+	tStart := time.Now()
+	conn, errCreate := CreateRFC2217Conn(server.ln.Addr().String())
+	if errCreate != nil {
+		t.Fatal(errCreate)
+	}
+	defer conn.Close()
+	if time.Millisecond*RFC2217NEGOTIATIONTIMEOUT/2 < time.Since(tStart) {
+		t.Errorf("negotiation took %v", time.Since(tStart))
+	}
+}
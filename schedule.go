@@ -0,0 +1,161 @@
+/*
+Measurement schedules for DutyCycle
+
+IntervalSchedule is aligned to wall clock. CronSchedule is parsed from 5 field cron expression
+"minute hour day-of-month month day-of-week", supporting lists, ranges and steps like "0-59/10 6-21 * * 1-5"
+*/
+
+package sds011
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Schedule interface {
+	Next(after time.Time) time.Time //First slot after given time. Zero if there is none
+}
+
+// Every Interval, aligned to local wall clock of after. 30min gives slots at :00 and :30.
+// Slots are counted from local midnight of each day, so with interval not dividing 24h first slot of day is at midnight
+type IntervalSchedule struct {
+	Interval time.Duration
+}
+
+func (p IntervalSchedule) Next(after time.Time) time.Time {
+	if p.Interval <= 0 {
+		return time.Time{}
+	}
+	y, m, d := after.Date()
+	hour, minute, sec := after.Clock()
+	wall := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(sec)*time.Second + time.Duration(after.Nanosecond())
+	lastOfDay := max(1, (24*time.Hour-1)/p.Interval) //Interval over a day is counted from midnight of after
+	n := wall/p.Interval + 1
+	for day := 0; ; day++ {
+		for ; n <= lastOfDay; n++ { //Wall clock time of slot might not exist on DST change
+			slot := time.Date(y, m, d+day, 0, 0, 0, int(n*p.Interval), after.Location())
+			if slot.After(after) {
+				return slot
+			}
+		}
+		n = 0 //Next day starts from its midnight
+	}
+}
+
+type cronField uint64 //Bit per allowed value
+
+type CronSchedule struct {
+	minute, hour, dom, month, dow cronField
+	domStar, dowStar              bool //Star fields do not restrict days. Otherwise day matches if dom or dow matches, like in cron
+	Location                      *time.Location
+}
+
+func parseCronField(s string, lo int, hi int) (cronField, error) {
+	var result cronField
+	for _, part := range strings.Split(s, ",") {
+		rangePart, stepPart, haveStep := strings.Cut(part, "/")
+		step := 1
+		if haveStep {
+			n, errStep := strconv.Atoi(stepPart)
+			if errStep != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+		}
+		first, last := lo, hi
+		if rangePart != "*" {
+			a, b, isRange := strings.Cut(rangePart, "-")
+			n, errFirst := strconv.Atoi(a)
+			if errFirst != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			first, last = n, n
+			if isRange {
+				n, errLast := strconv.Atoi(b)
+				if errLast != nil {
+					return 0, fmt.Errorf("invalid range %q", part)
+				}
+				last = n
+			} else if haveStep {
+				last = hi //Like 5/15
+			}
+		}
+		if first < lo || hi < last || last < first {
+			return 0, fmt.Errorf("%q out of range %v-%v", part, lo, hi)
+		}
+		for v := first; v <= last; v += step {
+			result |= 1 << uint(v)
+		}
+	}
+	return result, nil
+}
+
+func (p cronField) has(v int) bool {
+	return p&(1<<uint(v)) != 0
+}
+
+// ParseCron parses "minute hour day-of-month month day-of-week". Sunday is 0 or 7. Local time is used
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	limits := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var parsed [5]cronField
+	for i, field := range fields {
+		f, errParse := parseCronField(field, limits[i][0], limits[i][1])
+		if errParse != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, errParse)
+		}
+		parsed[i] = f
+	}
+	if parsed[4].has(7) {
+		parsed[4] |= 1
+	}
+	return &CronSchedule{
+		minute:   parsed[0],
+		hour:     parsed[1],
+		dom:      parsed[2],
+		month:    parsed[3],
+		dow:      parsed[4],
+		domStar:  strings.HasPrefix(fields[2], "*"),
+		dowStar:  strings.HasPrefix(fields[4], "*"),
+		Location: time.Local,
+	}, nil
+}
+
+func (p *CronSchedule) dayMatches(t time.Time) bool {
+	domOk := p.dom.has(t.Day())
+	dowOk := p.dow.has(int(t.Weekday()))
+	if p.domStar || p.dowStar {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+func (p *CronSchedule) Next(after time.Time) time.Time {
+	t := after.In(p.Location).Truncate(time.Minute).Add(time.Minute)
+	tEnd := t.AddDate(5, 0, 0) //Like 30th of february never matches
+	for t.Before(tEnd) {
+		if !p.month.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, p.Location)
+			continue
+		}
+		if !p.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, p.Location)
+			continue
+		}
+		if !p.hour.has(t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, p.Location)
+			continue
+		}
+		if !p.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
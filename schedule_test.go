@@ -0,0 +1,73 @@
+package sds011
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" //Test zones also without system zoneinfo
+)
+
+func TestIntervalScheduleLocal(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	tests := []struct {
+		interval time.Duration
+		after    time.Time
+		want     time.Time
+	}{
+		{time.Hour, time.Date(2024, 3, 8, 10, 15, 0, 0, kolkata), time.Date(2024, 3, 8, 11, 0, 0, 0, kolkata)},
+		{30 * time.Minute, time.Date(2024, 3, 8, 10, 30, 0, 0, kolkata), time.Date(2024, 3, 8, 11, 0, 0, 0, kolkata)},
+		{24 * time.Hour, time.Date(2024, 3, 8, 10, 15, 0, 0, kolkata), time.Date(2024, 3, 9, 0, 0, 0, 0, kolkata)},
+		{7 * time.Minute, time.Date(2024, 3, 8, 23, 58, 0, 0, kolkata), time.Date(2024, 3, 9, 0, 0, 0, 0, kolkata)}, //Does not divide 24h
+		{7 * time.Minute, time.Date(2024, 3, 9, 0, 0, 0, 0, kolkata), time.Date(2024, 3, 9, 0, 7, 0, 0, kolkata)},
+		{7 * time.Minute, time.Date(2024, 3, 8, 23, 51, 0, 0, kolkata), time.Date(2024, 3, 8, 23, 55, 0, 0, kolkata)},
+		{48 * time.Hour, time.Date(2024, 3, 8, 10, 15, 0, 0, kolkata), time.Date(2024, 3, 10, 0, 0, 0, 0, kolkata)},
+	}
+	helsinki, errLoad := time.LoadLocation("Europe/Helsinki")
+	if errLoad != nil {
+		t.Fatal(errLoad)
+	}
+	tests = append(tests, []struct {
+		interval time.Duration
+		after    time.Time
+		want     time.Time
+	}{
+		{24 * time.Hour, time.Date(2024, 7, 1, 10, 0, 0, 0, helsinki), time.Date(2024, 7, 2, 0, 0, 0, 0, helsinki)},
+		{time.Hour, time.Date(2024, 3, 31, 2, 30, 0, 0, helsinki), time.Date(2024, 3, 31, 4, 0, 0, 0, helsinki)}, //03:00 does not exist
+		{24 * time.Hour, time.Date(2024, 3, 30, 12, 0, 0, 0, helsinki), time.Date(2024, 3, 31, 0, 0, 0, 0, helsinki)},
+	}...)
+	for _, test := range tests {
+		got := IntervalSchedule{Interval: test.interval}.Next(test.after)
+		if !got.Equal(test.want) {
+			t.Errorf("%v after %v: next is %v, want %v", test.interval, test.after, got, test.want)
+		}
+	}
+}
+
+func TestCronSchedule(t *testing.T) {
+	base := time.Date(2024, 3, 8, 21, 47, 30, 0, time.UTC) //Friday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0-59/10 * * * *", time.Date(2024, 3, 8, 21, 50, 0, 0, time.UTC)},
+		{"0 6-21 * * *", time.Date(2024, 3, 9, 6, 0, 0, 0, time.UTC)},
+		{"15,45 * * * 0,6", time.Date(2024, 3, 9, 0, 15, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 12 29 2 *", time.Date(2028, 2, 29, 12, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		sched, errParse := ParseCron(test.expr)
+		if errParse != nil {
+			t.Fatalf("%v: %v", test.expr, errParse)
+		}
+		sched.Location = time.UTC
+		if got := sched.Next(base); !got.Equal(test.want) {
+			t.Errorf("%v: next is %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, errParse := ParseCron(bad); errParse == nil {
+			t.Errorf("%q parsed without error", bad)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package sds011
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,29 +15,63 @@ const (
 )
 
 type Sds011 struct {
-	PassiveMode bool //Only listen
+	PassiveMode         bool         //Only listen
+	ForwardQueryResults bool         //QueryMeasurement result is also pushed to result channel. Always in active mode
+	WarmUp              WarmUpPolicy //What to do with readings inside warm-up window. QueryMeasurement results are only flagged
 	//SettingsInSync bool //If flips to offline (timeout etc... require settings check)
 
 	Id       uint16         //Listen only these messages
 	settings Sds011Settings //Change thru method
 
 	//Channels for reporting spontanious things
-	resultCh       chan Result
-	ErrorsCh       chan error  //Push nil if recovered or came online
-	DetectedSensor chan uint16 //In case of multiple sensors. add item here when found valid package with new ID
+	resultCh          chan Result
+	ErrorsCh          chan error //Push nil if recovered or came online
+	recoverableErrors int64      //Atomic, bad frames etc.. that did not stop Run
+	stats             *linkCounters
 
 	//Low level interface
-	conn Conn
+	conn   Conn
+	txLock sync.Locker //Held while request waits reply. Shared between sensors on same Bus
 
 	//Internal channels. Important to split inlet channels.. detecting reply is going to be much easier with this
 	filtreplyFromSensor chan Packet
+	filtdataFromSensor  chan Result
+	queryWaiting        int32 //Atomic, 1 while QueryMeasurement waits data
 
-	tPrevResultTime time.Time //How long since data
+	tPrevResultTime time.Time //How long since data. Guarded by stateMu
+	manualCounting  int32     //Atomic, non-zero while DutyCycle counts measurements instead of estimating from period
 
-	measurementCounter int //It is important to restore old readout and continue from there. Sensor wears down in each run
+	measurementCounter int         //It is important to restore old readout and continue from there. Sensor wears down in each run
+	counterMu          *sync.Mutex //Guards measurementCounter and counter store
+	counterStore       CounterStore
+	counterFlushEvery  time.Duration
+	tPrevCounterFlush  time.Time
+	flushedCounter     int
+
+	//Optional non-volatile write accounting
+	ledger   WriteLedger
+	budget   WriteBudget
+	ledgerMu *sync.Mutex //Budget check and count is one step
+
+	wear *WearTracker //Optional laser and fan runtime accounting
+
+	//Lifecycle state, see state.go
+	StateChanges chan StateTransition //Not pushed if full
+	stateMu      *sync.Mutex          //Guards also settings
+	state        SensorState
+	tWake        time.Time //When fan and laser started, for warm up
+	tLastData    time.Time
+	tRunStart    time.Time
+	timeouts     int //Consecutive reply timeouts
+
+	WatchdogGrace time.Duration //Result is overdue after period plus this
+	overdue       int32         //Atomic, 1 after NoDataError until data resumes
+
+	lastStable Result //For WARMUP_HOLD. Guarded by stateMu
+	haveStable bool
 
 	//Power enable is not really needed. Sensor have stop command. But it is good to have switch as sensor reset
-	powerEnable bool //If system have gpio controlled hiside switch for sensor. Stops counting time etc..
+	powerEnable bool //If system have gpio controlled hiside switch for sensor. Stops counting time etc.. Guarded by stateMu
 }
 
 type Sds011Settings struct {
@@ -58,83 +95,243 @@ func InitSds011(Id uint16, passive bool, conn Conn, resultCh chan Result, initia
 
 		/*toSensor:            toSensorCh,
 		fromSensor:          fromSensorCh,*/
-		conn: conn,
+		conn:   conn,
+		txLock: &sync.Mutex{},
 
 		filtreplyFromSensor: make(chan Packet, 1), //Just passing thru
+		filtdataFromSensor:  make(chan Result, 1),
 		resultCh:            resultCh,
-		ErrorsCh:            make(chan error, 2), //Optional... get error info from here
-		DetectedSensor:      make(chan uint16, 10),
+		ErrorsCh:            make(chan error, 2),       //Optional... get error info from here
 		measurementCounter:  initialMeasurementCounter, //What was counter when stopped (last reported)
+		counterMu:           &sync.Mutex{},
+		ledgerMu:            &sync.Mutex{},
+		stats:               newLinkCounters(),
 		powerEnable:         true,
 		tPrevResultTime:     time.Now(),
+		StateChanges:        make(chan StateTransition, 10),
+		stateMu:             &sync.Mutex{},
+		WatchdogGrace:       time.Millisecond * WATCHDOGGRACE,
 	}
 
 	return result
 }
 
 // For reading and writing settings. Data query is different
-func (p *Sds011) queryAndWaitResponse(query Packet) (Packet, error) {
+// Waits TIMEOUTRESPONSE or until ctx is done, whichever comes first
+func (p *Sds011) queryAndWaitResponse(ctx context.Context, query Packet) (Packet, error) {
+	p.txLock.Lock()
+	defer p.txLock.Unlock()
+
 	for 0 < len(p.filtreplyFromSensor) {
 		<-p.filtreplyFromSensor //Clear up
 	}
-	/*
-		for 0 < len(p.toSensor) {
-			<-p.toSensor //Clear up
-		}*/
 
-	if !p.powerEnable {
-		return Packet{}, fmt.Errorf("power line not enabled") //Internal mess up if software makes queries while sensor is disabled
+	if !p.powerEnabled() {
+		return Packet{}, ErrPowerDisabled //Internal mess up if software makes queries while sensor is disabled
 	}
 
-	//p.toSensor <- query
 	sendErr := p.conn.Send(query)
 	if sendErr != nil {
 		return Packet{}, sendErr
 	}
 
 	tStart := time.Now()
-	for time.Since(tStart) < time.Millisecond*TIMEOUTRESPONSE {
-		if 0 < len(p.filtreplyFromSensor) {
-			reply := <-p.filtreplyFromSensor
-			//fmt.Printf("GOT REPLY %s\n", reply)
+	ctxResponse, cancel := context.WithTimeout(ctx, time.Millisecond*TIMEOUTRESPONSE)
+	defer cancel()
+	for {
+		select {
+		case reply := <-p.filtreplyFromSensor:
 			if reply.CommandID == COMMANDID_RESPONSE { //Ignore other stuff. Like shorted rx tx echo back etc...
+				p.stats.latency(time.Since(tStart))
+				p.stateReplied()
 				return reply, nil
 			}
+		case <-ctxResponse.Done():
+			if ctx.Err() != nil { //Caller gave up, not sensor
+				return Packet{}, ctx.Err()
+			}
+			errTimeout := fmt.Errorf("%w, no reply in %s", ErrTimeout, time.Since(tStart))
+			p.stats.timeout()
+			p.stateTimeout(false, errTimeout)
+			return Packet{}, errTimeout
 		}
-		time.Sleep(50 * time.Millisecond) //granularity
 	}
-	//TIMEOUT
-	//p.SettingsInSync = false
-	return Packet{}, fmt.Errorf("timeout %s", time.Since(tStart))
 }
 
 // If system have hiside power enable for sensor
 func (p *Sds011) PowerLine(enabled bool) {
+	p.stateMu.Lock()
 	if !p.powerEnable && enabled {
 		//Switching on
 		p.tPrevResultTime = time.Now() //Prevent counter "explosion"
 	}
 	p.powerEnable = enabled
+	p.stateMu.Unlock()
+	p.setWearWorking(enabled) //Sensor starts working after power up
+	p.statePower(enabled)
+}
+
+func (p *Sds011) powerEnabled() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.powerEnable
+}
+
+/*
+UseCounterStore loads measurement counter from store (replaces initialMeasurementCounter)
+and saves it on change, at most once per flushInterval. Call FlushCounter before exit
+*/
+func (p *Sds011) UseCounterStore(store CounterStore, flushInterval time.Duration) error {
+	counter, errLoad := store.LoadCounter(p.Id)
+	if errLoad != nil {
+		return errLoad
+	}
+	p.counterMu.Lock()
+	defer p.counterMu.Unlock()
+	p.counterStore = store
+	p.counterFlushEvery = flushInterval
+	p.measurementCounter = counter
+	p.flushedCounter = counter
+	return nil
+}
+
+// Must hold counterMu
+func (p *Sds011) flushCounterLocked() error {
+	if p.counterStore == nil || p.flushedCounter == p.measurementCounter {
+		return nil
+	}
+	p.tPrevCounterFlush = time.Now()
+	errSave := p.counterStore.SaveCounter(p.Id, p.measurementCounter)
+	if errSave != nil {
+		return errSave
+	}
+	p.flushedCounter = p.measurementCounter
+	return nil
+}
+
+// FlushCounter saves measurement counter now if it have changed since last save
+func (p *Sds011) FlushCounter() error {
+	p.counterMu.Lock()
+	defer p.counterMu.Unlock()
+	return p.flushCounterLocked()
+}
+
+// MeasurementCounter is number of measurements sensor have made
+func (p *Sds011) MeasurementCounter() int {
+	p.counterMu.Lock()
+	defer p.counterMu.Unlock()
+	return p.measurementCounter
+}
+
+// Increases counter and saves if flush interval have passed. Returns new value
+func (p *Sds011) addMeasurements(n int) int {
+	p.counterMu.Lock()
+	defer p.counterMu.Unlock()
+	p.measurementCounter += n
+	if p.counterFlushEvery <= time.Since(p.tPrevCounterFlush) {
+		errFlush := p.flushCounterLocked()
+		if errFlush != nil {
+			p.reportError(fmt.Errorf("saving measurement counter failed %w", errFlush))
+		}
+	}
+	return p.measurementCounter
+}
+
+// UseWearTracker enables runtime accounting. Wear status is reported with each Result
+func (p *Sds011) UseWearTracker(tracker *WearTracker) {
+	p.wear = tracker
+	p.setWearWorking(p.powerEnabled())
+	p.updateSettings(p.currentSettings())
+}
+
+func (p *Sds011) setWearWorking(working bool) {
+	if p.wear == nil {
+		return
+	}
+	errWear := p.wear.SetWorking(working)
+	if errWear != nil {
+		p.reportError(fmt.Errorf("saving wear failed %w", errWear))
+	}
+}
+
+// Last known settings. Sensor methods are called from many goroutines
+func (p *Sds011) currentSettings() Sds011Settings {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.settings
+}
+
+// Settings that are now on sensor
+func (p *Sds011) updateSettings(st Sds011Settings) {
+	p.stateMu.Lock()
+	p.settings = st
+	p.stateMu.Unlock()
+	if p.wear == nil {
+		return
+	}
+	errWear := p.wear.SetPeriod(st.Period)
+	if errWear != nil {
+		p.reportError(fmt.Errorf("saving wear failed %w", errWear))
+	}
 }
 
 /*
 Settings
 */
 
-func (p *Sds011) readQueryMode() (bool, error) {
-	workModeReply, replyErr := p.queryAndWaitResponse(NewPacket_SetQueryMode(p.Id, false, false))
+// UseWriteLedger enables counting non-volatile writes. Writes past budget are refused with BudgetError
+func (p *Sds011) UseWriteLedger(ledger WriteLedger, budget WriteBudget) {
+	p.ledger = ledger
+	p.budget = budget
+}
+
+// WriteCounts tells how many non-volatile writes library have made to this sensor. For monitoring
+func (p *Sds011) WriteCounts() (WriteCounts, error) {
+	if p.ledger == nil {
+		return WriteCounts{}, fmt.Errorf("write ledger not in use")
+	}
+	return p.ledger.LoadWrites(p.Id)
+}
+
+// Checks budget and counts write before it is sent. Counted even if reply is lost, sensor might have written anyway
+func (p *Sds011) reserveWrite(fun byte) error {
+	if p.ledger == nil {
+		return nil
+	}
+	p.ledgerMu.Lock()
+	defer p.ledgerMu.Unlock()
+	counts, errLoad := p.ledger.LoadWrites(p.Id)
+	if errLoad != nil {
+		return errLoad
+	}
+	if 0 < p.budget.Lifetime && p.budget.Lifetime <= counts.Lifetime {
+		return &BudgetError{Id: p.Id, Daily: false, Limit: p.budget.Lifetime, Used: counts.Lifetime}
+	}
+	if 0 < p.budget.Daily && p.budget.Daily <= counts.Today() {
+		return &BudgetError{Id: p.Id, Daily: true, Limit: p.budget.Daily, Used: counts.Today()}
+	}
+	counts.add(fun)
+	return p.ledger.SaveWrites(p.Id, counts)
+}
+
+func (p *Sds011) readQueryMode(ctx context.Context) (bool, error) {
+	workModeReply, replyErr := p.queryAndWaitResponse(ctx, NewPacket_SetQueryMode(p.Id, false, false))
 	if replyErr != nil {
 		return false, replyErr
 	}
 	return workModeReply.GetQueryMode()
 }
 
-func (p *Sds011) writeQueryMode(queryMode bool) error {
+func (p *Sds011) writeQueryMode(ctx context.Context, queryMode bool) error {
 	if p.PassiveMode {
-		return fmt.Errorf("write not allowed in passive mode")
+		return ErrPassiveMode
+	}
+	errReserve := p.reserveWrite(FUNNUMBER_REPORTINGMODE)
+	if errReserve != nil {
+		return errReserve
 	}
 
-	workModeReply, replyErr := p.queryAndWaitResponse(NewPacket_SetQueryMode(p.Id, true, queryMode))
+	workModeReply, replyErr := p.queryAndWaitResponse(ctx, NewPacket_SetQueryMode(p.Id, true, queryMode))
 	if replyErr != nil {
 		return replyErr
 	}
@@ -143,24 +340,28 @@ func (p *Sds011) writeQueryMode(queryMode bool) error {
 		return err
 	}
 	if resp != queryMode {
-		return fmt.Errorf("setting query mode to %v failed", queryMode)
+		return &VerifyError{Setting: "query mode", Want: queryMode, Got: resp}
 	}
 	return nil
 }
 
-func (p *Sds011) readPeriod() (byte, error) {
-	periodReply, replyErr := p.queryAndWaitResponse(NewPacket_SetPeriod(p.Id, false, 0))
+func (p *Sds011) readPeriod(ctx context.Context) (byte, error) {
+	periodReply, replyErr := p.queryAndWaitResponse(ctx, NewPacket_SetPeriod(p.Id, false, 0))
 	if replyErr != nil {
 		return 0, replyErr
 	}
 	return periodReply.GetPeriod()
 }
-func (p *Sds011) writePeriod(period byte) error {
+func (p *Sds011) writePeriod(ctx context.Context, period byte) error {
 	if p.PassiveMode {
-		return fmt.Errorf("write not allowed in passive mode")
+		return ErrPassiveMode
+	}
+	errReserve := p.reserveWrite(FUNNUMBER_PERIOD)
+	if errReserve != nil {
+		return errReserve
 	}
 
-	periodReply, replyErr := p.queryAndWaitResponse(NewPacket_SetPeriod(p.Id, true, period))
+	periodReply, replyErr := p.queryAndWaitResponse(ctx, NewPacket_SetPeriod(p.Id, true, period))
 	if replyErr != nil {
 		return replyErr
 	}
@@ -169,13 +370,13 @@ func (p *Sds011) writePeriod(period byte) error {
 		return err
 	}
 	if resp != period {
-		return fmt.Errorf("setting period to %v failed. Reported %v", period, resp)
+		return &VerifyError{Setting: "period", Want: period, Got: resp}
 	}
 	return nil
 }
 
-func (p *Sds011) readVersion() (string, error) {
-	versionReply, replyErr := p.queryAndWaitResponse(NewPacket_QueryVersion(p.Id))
+func (p *Sds011) readVersion(ctx context.Context) (string, error) {
+	versionReply, replyErr := p.queryAndWaitResponse(ctx, NewPacket_QueryVersion(p.Id))
 	if replyErr != nil {
 		return "", replyErr
 	}
@@ -183,28 +384,84 @@ func (p *Sds011) readVersion() (string, error) {
 }
 
 // Read what is going on device. Call if wanted
-func (p *Sds011) readSettings() (Sds011Settings, error) {
-	queryMode, queryModeErr := p.readQueryMode()
+func (p *Sds011) readSettings(ctx context.Context) (Sds011Settings, error) {
+	st, errRead := p.readStoredSettings(ctx)
+	if errRead != nil {
+		return st, errRead
+	}
+	version, versionErr := p.readVersion(ctx)
+	if versionErr != nil {
+		return p.currentSettings(), versionErr //Return something "neutral"
+	}
+	st.Version = version
+	return st, nil
+}
+
+// Query mode and period, settings that can drift. Version is kept from earlier read
+func (p *Sds011) readStoredSettings(ctx context.Context) (Sds011Settings, error) {
+	queryMode, queryModeErr := p.readQueryMode(ctx)
 	if queryModeErr != nil {
-		return p.settings, queryModeErr //Return something "neutral"
+		return p.currentSettings(), queryModeErr //Return something "neutral"
 	}
-	period, periodErr := p.readPeriod()
+	period, periodErr := p.readPeriod(ctx)
 	if periodErr != nil {
-		return p.settings, periodErr //Return something "neutral"
-	}
-	version, versionErr := p.readVersion()
-	if versionErr != nil {
-		return p.settings, versionErr //Return something "neutral"
+		return p.currentSettings(), periodErr //Return something "neutral"
 	}
-	return Sds011Settings{QueryMode: queryMode, Period: period, Version: version}, nil
+	return Sds011Settings{QueryMode: queryMode, Period: period, Version: p.currentSettings().Version}, nil
 }
 
-// Response comes from result channel  TODO Timeout checking?
+// Response comes from result channel. Use QueryMeasurement if waiting is needed
 func (p *Sds011) DoQuery() error {
 	pkg := NewPacket_QueryData(p.Id)
+	p.txLock.Lock()
+	defer p.txLock.Unlock()
 	return p.conn.Send(pkg)
 }
 
+/*
+QueryMeasurement sends data query and waits measurement reply. For query mode.
+Returns ErrTimeout if sensor did not reply (sleeping or unplugged).
+Result is not pushed to result channel unless ForwardQueryResults is set.
+In active mode reply can not be told apart from spontanious reading, so readings are pushed to result channel also while waiting
+*/
+func (p *Sds011) QueryMeasurement(ctx context.Context) (Result, error) {
+	p.txLock.Lock()
+	defer p.txLock.Unlock()
+
+	for 0 < len(p.filtdataFromSensor) {
+		<-p.filtdataFromSensor //Clear up
+	}
+
+	if !p.powerEnabled() {
+		return Result{}, ErrPowerDisabled
+	}
+
+	atomic.StoreInt32(&p.queryWaiting, 1)
+	defer atomic.StoreInt32(&p.queryWaiting, 0)
+
+	sendErr := p.conn.Send(NewPacket_QueryData(p.Id))
+	if sendErr != nil {
+		return Result{}, sendErr
+	}
+
+	tStart := time.Now()
+	ctxResponse, cancel := context.WithTimeout(ctx, time.Millisecond*TIMEOUTRESPONSE)
+	defer cancel()
+	select {
+	case res := <-p.filtdataFromSensor:
+		p.stats.latency(time.Since(tStart))
+		return res, nil
+	case <-ctxResponse.Done():
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		errTimeout := fmt.Errorf("%w, no data reply in %s", ErrTimeout, time.Since(tStart))
+		p.stats.timeout()
+		p.stateTimeout(true, errTimeout)
+		return Result{}, errTimeout
+	}
+}
+
 //IS NOT RECOMMENDED... makes things messy. It is unique from factory
 /*
 func (p *Sds011) ChangeID(newId byte) error {
@@ -216,71 +473,78 @@ func (p *Sds011) ChangeID(newId byte) error {
 }
 */
 
-func (p *Sds011) ChangeToWork(toWork bool) error {
-	reply, replyErr := p.queryAndWaitResponse(NewPacket_SetWorkMode(p.Id, true, toWork))
+func (p *Sds011) ChangeToWork(ctx context.Context, toWork bool) error {
+	reply, replyErr := p.queryAndWaitResponse(ctx, NewPacket_SetWorkMode(p.Id, true, toWork))
 	if replyErr != nil {
-		return fmt.Errorf("change to work failed with %v", replyErr.Error())
+		return fmt.Errorf("change to work failed with %w", replyErr)
 	}
 	target, errGetWork := reply.GetWorkMode()
 	if errGetWork != nil {
 		return errGetWork
 	}
+	p.setWearWorking(target)
+	p.stateWorkMode(target, true)
 	if target != toWork {
-		return fmt.Errorf("changing work to %v failed", toWork)
+		return &VerifyError{Setting: "work mode", Want: toWork, Got: target}
 	}
 	return nil
 }
 
 // Not like working/broken.... it means working not sleeping
-func (p *Sds011) IsWorking() (bool, error) {
-	reply, replyErr := p.queryAndWaitResponse(NewPacket_SetWorkMode(p.Id, false, false))
+func (p *Sds011) IsWorking(ctx context.Context) (bool, error) {
+	reply, replyErr := p.queryAndWaitResponse(ctx, NewPacket_SetWorkMode(p.Id, false, false))
 	if replyErr != nil {
 		return false, replyErr
 	}
-	return reply.GetWorkMode()
+	working, errWork := reply.GetWorkMode()
+	if errWork == nil {
+		p.setWearWorking(working)
+		p.stateWorkMode(working, false)
+	}
+	return working, errWork
 }
 
-func (p *Sds011) SyncSettingsFromDevice() error {
-	st, err := p.readSettings()
+func (p *Sds011) SyncSettingsFromDevice(ctx context.Context) error {
+	st, err := p.readSettings(ctx)
 	if err != nil {
 		return err
 	}
-	p.settings = st
+	p.updateSettings(st)
 	return nil
 }
 
-func (p *Sds011) GetSettings() (Sds011Settings, error) {
-	errSync := p.SyncSettingsFromDevice()
-	return p.settings, errSync
+func (p *Sds011) GetSettings(ctx context.Context) (Sds011Settings, error) {
+	errSync := p.SyncSettingsFromDevice(ctx)
+	return p.currentSettings(), errSync
 }
 
 /*
 Check situation first from sensor. Do not update if not needed, avoid re-flashing eeprom
 */
-func (p *Sds011) SetSettings(newSettings Sds011Settings) error {
+func (p *Sds011) SetSettings(ctx context.Context, newSettings Sds011Settings) error {
 	if 30 < newSettings.Period {
 		return fmt.Errorf("invalid period %v", newSettings.Period)
 	}
 
 	if p.PassiveMode {
-		return fmt.Errorf("write not allowed in passive mode")
+		return ErrPassiveMode
 	}
-	p.settings = newSettings
+	p.updateSettings(newSettings)
 
 	//Read current settings and avoid flash wearout :)
-	onSensorSettings, errRead := p.readSettings()
+	onSensorSettings, errRead := p.readSettings(ctx)
 	if errRead != nil {
 		return errRead
 	}
 
-	if p.settings.Period != onSensorSettings.Period {
-		errWrite := p.writePeriod(p.settings.Period)
+	if newSettings.Period != onSensorSettings.Period {
+		errWrite := p.writePeriod(ctx, newSettings.Period)
 		if errWrite != nil {
 			return errWrite
 		}
 	}
-	if p.settings.QueryMode != onSensorSettings.QueryMode {
-		errWrite := p.writeQueryMode(p.settings.QueryMode)
+	if newSettings.QueryMode != onSensorSettings.QueryMode {
+		errWrite := p.writeQueryMode(ctx, newSettings.QueryMode)
 		if errWrite != nil {
 			return errWrite
 		}
@@ -290,72 +554,156 @@ func (p *Sds011) SetSettings(newSettings Sds011Settings) error {
 
 // Does reporting non-blocking way. If end user is not intrested errors :(
 func (p *Sds011) reportError(err error) {
-	if len(p.ErrorsCh) <= cap(p.ErrorsCh) {
-		p.ErrorsCh <- err
+	select {
+	case p.ErrorsCh <- err:
+	default:
 	}
 }
 
-func (p *Sds011) processFromSensor(pack Packet) error {
+// Stats is snapshot of link quality seen by this sensor. Frames are counted only for own ID
+func (p *Sds011) Stats() LinkStats {
+	return p.stats.snapshot()
+}
+
+// RecoverableErrorCount tells how many bad frames etc.. Run have reported on ErrorsCh and continued
+func (p *Sds011) RecoverableErrorCount() int64 {
+	return atomic.LoadInt64(&p.recoverableErrors)
+}
+
+// Returns err back if it is fatal
+func (p *Sds011) handleRunError(err error) error {
+	if !IsRecoverable(err) {
+		return err
+	}
+	p.stats.parseError(err)
+	atomic.AddInt64(&p.recoverableErrors, 1)
+	p.reportError(err)
+	return nil
+}
+
+// How many measurements sensor have made since previous data
+func (p *Sds011) newMeasurements() int {
+	if atomic.LoadInt32(&p.manualCounting) != 0 {
+		return 0
+	}
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	//If enough since previous time. Then it is more than extra poll query
+	since := time.Since(p.tPrevResultTime).Seconds()
+	if since < p.settings.PeriodDuration().Seconds()-1 {
+		return 0
+	}
+	p.tPrevResultTime = time.Now()
+	if p.settings.QueryMode {
+		//On query mode. One must estimate how many periods have happend
+		//Even with the zero communication system can run
+		return int(math.Floor(since / p.settings.PeriodDuration().Seconds()))
+	}
+	return 1 //This is clearly the event. Spontanious sending is more accurate
+}
+
+func (p *Sds011) processFromSensor(ctx context.Context, pack Packet) error {
 	if !pack.Valid {
-		return fmt.Errorf("discarding packet. Should not happen bad implementation")
+		return fmt.Errorf("discarding packet. Should not happen bad implementation %w", ErrInvalidPacket)
 	}
 
 	if !pack.MatchToId(p.Id) {
-		if len(p.DetectedSensor) < cap(p.DetectedSensor) {
-			p.DetectedSensor <- pack.DeviceID
-		}
-		return nil
+		return nil //Other sensors on same line. Use Bus for detecting those
 	}
+	p.stats.frame(pack.CommandID) //CMD is also counted as echo from returned error
 
-	if !p.powerEnable { //Power should be off. Failed power switch or bug in the software
+	if !p.powerEnabled() { //Power should be off. Failed power switch or bug in the software
 		p.reportError(fmt.Errorf("sensor switch fail, recieved packet %s", pack))
 	}
 	switch pack.CommandID {
 	case COMMANDID_DATAREPLY:
 		measResult, errMeas := pack.GetMeasurement()
 		if errMeas == nil {
-			//If enough since previous time. Then it is more than extra poll query
-			if p.settings.PeriodDuration().Seconds()-1 <= time.Since(p.tPrevResultTime).Seconds() {
-				if p.settings.QueryMode {
-					//On query mode. One must estimate how many periods have happend
-					//Even with the zero communication system can run
-					p.measurementCounter += int(math.Floor(time.Since(p.tPrevResultTime).Seconds() / p.settings.PeriodDuration().Seconds()))
-				} else {
-					p.measurementCounter++ //This is clearly the event. Spontanious sending is more accurate
+			//Increase counter. Recieving data does not prove anything.
+			measResult.MeasurementCounter = p.addMeasurements(p.newMeasurements())
+			measResult.Time = time.Now()
+			if p.stateData() {
+				measResult.Quality = QUALITY_WARMINGUP
+			}
+			p.feedWatchdog()
+			if p.wear != nil {
+				measResult.Wear = p.wear.Status()
+			}
+			if atomic.LoadInt32(&p.queryWaiting) == 1 {
+				select {
+				case p.filtdataFromSensor <- measResult:
+				default:
+				}
+				if !p.ForwardQueryResults && p.currentSettings().QueryMode {
+					return nil
 				}
-				p.tPrevResultTime = time.Now()
 			}
-
-			//Increase counter. Recieving data does not prove anything.
-
-			measResult.MeasurementCounter = p.measurementCounter
-			p.resultCh <- measResult
+			pushResult, keep := p.applyWarmUp(measResult)
+			if !keep {
+				return nil
+			}
+			select {
+			case p.resultCh <- pushResult:
+			case <-ctx.Done(): //Nobody reading results and asked to stop
+				return ctx.Err()
+			}
 		}
 	case COMMANDID_RESPONSE:
-		p.filtreplyFromSensor <- pack
+		select {
+		case p.filtreplyFromSensor <- pack:
+		default: //Nobody waiting reply, late or spontanious response
+		}
 	case COMMANDID_CMD:
-		return fmt.Errorf("!!!! WARNING SDS011 is recieving in wrong way CMD %s possible RX-TX short", pack)
+		return fmt.Errorf("%w, SDS011 is recieving in wrong way CMD %s possible RX-TX short", ErrEcho, pack)
 
 	default: //Should not really happen. Packet filtered earlier in stage. Needed if bad message transfer implemention
-		return fmt.Errorf("should not happen bad message transfer implementation INVALID PACKET %v, DISCARDING", pack)
+		return &FrameError{Offset: 1, Reason: fmt.Sprintf("should not happen bad message transfer implementation INVALID PACKET %v, DISCARDING", pack)}
 	}
 	return nil
 }
 
 /*
- */
-func (p *Sds011) Run() error {
+Run processes packets from conn until ctx is done or conn fails.
+Recoverable errors (see IsRecoverable) are reported on ErrorsCh and counted, Run keeps reading.
+Cancel ctx and close conn for shutdown, Run returns after blocking Recieve call returns
+*/
+func (p *Sds011) Run(ctx context.Context) error {
+	p.stateMu.Lock()
+	p.tRunStart = time.Now()
+	if p.state == STATE_UNKNOWN {
+		p.setStateLocked(STATE_CONNECTING, "run started")
+	}
+	p.stateMu.Unlock()
+
+	ctxWatchdog, cancelWatchdog := context.WithCancel(ctx)
+	defer cancelWatchdog()
+	go p.runWatchdog(ctxWatchdog)
+
 	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		packet, errRecv := p.conn.Recieve()
 		if errRecv != nil {
-			return errRecv
+			errFatal := p.handleRunError(errRecv)
+			if errFatal != nil {
+				p.setState(STATE_FAULTED, errFatal.Error())
+				return errFatal
+			}
+			continue
 		}
 		if packet != nil {
-			errProcess := p.processFromSensor(*packet)
+			errProcess := p.processFromSensor(ctx, *packet)
 			if errProcess != nil {
-				return errProcess
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				errFatal := p.handleRunError(errProcess)
+				if errFatal != nil {
+					p.setState(STATE_FAULTED, errFatal.Error())
+					return errFatal
+				}
 			}
 		}
 	}
-
 }
@@ -0,0 +1,187 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueryMeasurement(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	results := make(chan Result, 3)
+	sensor := InitSds011(0xA160, false, conn, results, 0)
+	sensor.updateSettings(Sds011Settings{QueryMode: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	go func() { //Reply only first query, sensor "falls asleep" after that
+		query := <-conn.sent
+		if query.CommandID == COMMANDID_CMD && query.Data[0] == FUNNUMBER_QUERYDATA {
+			conn.packets <- NewPacket_DataReply(query.DeviceID, 1236, 2618)
+		}
+	}()
+
+	res, errQuery := sensor.QueryMeasurement(ctx)
+	if errQuery != nil {
+		t.Fatalf("query failed %v", errQuery)
+	}
+	if res.SmallReg != 1236 || res.LargeReg != 2618 {
+		t.Errorf("invalid result %#v", res)
+	}
+	if len(results) != 0 {
+		t.Errorf("result forwarded to result channel")
+	}
+
+	_, errQuery = sensor.QueryMeasurement(ctx)
+	if !errors.Is(errQuery, ErrTimeout) {
+		t.Errorf("expected timeout, got %v", errQuery)
+	}
+}
+
+// Spontanious readings are not swallowed while query waits in active mode
+func TestQueryMeasurementActiveMode(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	results := make(chan Result, 3)
+	sensor := InitSds011(0xA160, false, conn, results, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	go func() {
+		<-conn.sent
+		conn.packets <- NewPacket_DataReply(0xA160, 11, 22)
+	}()
+	if _, errQuery := sensor.QueryMeasurement(ctx); errQuery != nil {
+		t.Fatalf("query failed %v", errQuery)
+	}
+	select {
+	case res := <-results:
+		if res.SmallReg != 11 || res.LargeReg != 22 {
+			t.Errorf("invalid result %#v", res)
+		}
+	case <-ctx.Done():
+		t.Errorf("reading during query not forwarded in active mode")
+	}
+}
+
+func TestRunContinuesAfterBadFrame(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), errs: make(chan error, 3), sent: make(chan Packet, 10)}
+	results := make(chan Result, 3)
+	sensor := InitSds011(0xA160, true, conn, results, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- sensor.Run(ctx) }()
+
+	conn.errs <- ErrChecksum
+	conn.errs <- &FrameError{Offset: 0, Reason: "junk"}
+	for 0 < len(conn.errs) {
+		time.Sleep(time.Millisecond)
+	}
+	conn.packets <- NewPacket_DataReply(0xA160, 10, 20)
+
+	select {
+	case <-results:
+	case err := <-runErr:
+		t.Fatalf("run stopped %v", err)
+	case <-ctx.Done():
+		t.Fatalf("no result after bad frames")
+	}
+	if sensor.RecoverableErrorCount() != 2 {
+		t.Errorf("expected 2 recoverable errors, got %v", sensor.RecoverableErrorCount())
+	}
+
+	conn.errs <- errors.New("device gone")
+	select {
+	case err := <-runErr:
+		if IsRecoverable(err) {
+			t.Errorf("run stopped with recoverable error %v", err)
+		}
+	case <-ctx.Done():
+		t.Errorf("run did not stop on fatal error")
+	}
+}
+
+func TestCounterStore(t *testing.T) {
+	store := FileCounterStore{Dir: t.TempDir()}
+	store.SaveCounter(0xA160, 41)
+
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	results := make(chan Result, 3)
+	sensor := InitSds011(0xA160, true, conn, results, 0)
+	errUse := sensor.UseCounterStore(store, time.Hour)
+	if errUse != nil {
+		t.Fatalf("loading counter failed %v", errUse)
+	}
+	sensor.tPrevResultTime = time.Now().Add(-time.Minute) //Active mode, period passed
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+	conn.packets <- NewPacket_DataReply(0xA160, 10, 20)
+	res := <-results
+	if res.MeasurementCounter != 42 {
+		t.Errorf("counter did not continue from stored, got %v", res.MeasurementCounter)
+	}
+
+	errFlush := sensor.FlushCounter()
+	if errFlush != nil {
+		t.Fatalf("flush failed %v", errFlush)
+	}
+	stored, _ := store.LoadCounter(0xA160)
+	if stored != 42 {
+		t.Errorf("stored counter %v", stored)
+	}
+}
+
+func TestCounterStoreLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "measuredcounter"), []byte("86"), 0666)
+	store := FileCounterStore{Dir: dir, LegacyFile: "measuredcounter"}
+
+	if counter, err := store.LoadCounter(0xA160); counter != 86 || err != nil {
+		t.Errorf("legacy counter not read, got %v err=%v", counter, err)
+	}
+	store.SaveCounter(0xA160, 87)
+	os.WriteFile(filepath.Join(dir, "measuredcounter"), []byte("1"), 0666)
+	if counter, err := store.LoadCounter(0xA160); counter != 87 || err != nil {
+		t.Errorf("per-ID file not preferred, got %v err=%v", counter, err)
+	}
+}
+
+// Run with -race. Power line is switched from other goroutine than Run
+func TestPowerLineWhileRunning(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	results := make(chan Result, 100)
+	sensor := InitSds011(0xA160, true, conn, results, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			sensor.PowerLine(i%2 == 1)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		conn.packets <- NewPacket_DataReply(0xA160, 10, 20)
+	}
+	<-done
+	sensor.PowerLine(true)
+	for i := 0; i < 50; i++ {
+		select {
+		case <-results:
+		case <-ctx.Done():
+			t.Fatalf("got %v results of 50", i)
+		}
+	}
+}
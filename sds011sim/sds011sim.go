@@ -9,17 +9,20 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/hjkoskel/listserialports"
 	"github.com/hjkoskel/sds011"
+	"github.com/hjkoskel/sds011/sim"
 )
 
 func main() {
-	fmt.Printf("Single sensor SDS011 SIM")
+	fmt.Printf("SDS011 SIM\n")
 
 	pSerialDevice := flag.String("s", "", "serial device file")
-	pDeviceId := flag.String("id", "ABCD", "SDS011 ID in hex 16bit no 0xFFFF")
+	pDeviceId := flag.String("id", "ABCD", "SDS011 IDs in hex 16bit no 0xFFFF. Comma separated list for multiple sensors on bus, same ID can be repeated")
+	pCollision := flag.String("collision", sim.COLLISION_INTERLEAVE.String(), "what happens when sensors reply at same time: interleave, garble or none")
 	pUiport := flag.Int("uiport", 8088, "Port for https hosting")
 	pHttpsCrt := flag.String("crt", "./keys/https-server.crt", "crt file for local ui")
 	pHttpsKey := flag.String("key", "./keys/https-server.key", "key file for local ui")
@@ -41,104 +44,62 @@ func main() {
 		os.Exit(0)
 	}
 
-	sensorId, errIdparse := strconv.ParseInt(*pDeviceId, 16, 64)
-	if errIdparse != nil {
-		fmt.Printf("INVALID Device id %v  err=%v\n", *pDeviceId, errIdparse.Error())
+	collision, errCollision := sim.ParseCollisionMode(*pCollision)
+	if errCollision != nil {
+		fmt.Printf("%v\n", errCollision.Error())
 		os.Exit(-1)
 	}
-	if (0xFFFF <= sensorId) || (sensorId < 0) {
-		fmt.Printf("INVALID Device id %X\n", sensorId)
-		os.Exit(-1)
-	}
-
-	//TODO load from disk if available
-	fmt.Printf("\nThe sensor id is %X\n", sensorId)
-	simsensor := InitSimSensor(uint16(sensorId))
-	fmt.Printf("sim=%#v\n", simsensor)
-
-	modelUpdates := make(chan SensorModel, 3)
-	statusChanges := make(chan SensorModelStatus, 3) //Update UI
-
-	//packetsToSensor := make(chan sds011.SDS011Packet, 6)
 
-	/*
-		go func() {
-			//TODO DEBUGGIKANAVALUUPPI
-			for {
-				fmt.Printf("-------------------------\n")
-				fmt.Printf("model updates %v/%v\n", len(modelUpdates), cap(modelUpdates))
-				fmt.Printf("status changes %v/%v\n", len(statusChanges), cap(statusChanges))
-				fmt.Printf("packets from sensor %v/%v  to sensor %v/%v\n", len(packetsFromSensor), cap(packetsFromSensor), len(packetsToSensor), cap(packetsToSensor))
-				fmt.Printf("-------------------------\n")
-				time.Sleep(1500 * time.Millisecond)
-			}
-		}()
-	*/
+	logf := func(format string, a ...interface{}) {
+		color.Set(color.FgCyan)
+		fmt.Printf(format, a...)
+		color.Unset()
+	}
+	simbus := sim.NewSimBus(collision, logf)
+	for _, idString := range strings.Split(*pDeviceId, ",") {
+		sensorId, errIdparse := strconv.ParseInt(strings.TrimSpace(idString), 16, 64)
+		if errIdparse != nil {
+			fmt.Printf("INVALID Device id %v  err=%v\n", idString, errIdparse.Error())
+			os.Exit(-1)
+		}
+		if (0xFFFF <= sensorId) || (sensorId < 0) {
+			fmt.Printf("INVALID Device id %X\n", sensorId)
+			os.Exit(-1)
+		}
+		//TODO load from disk if available
+		fmt.Printf("Sensor id %X on bus\n", sensorId)
+		simbus.Add(sim.New(uint16(sensorId), sim.Options{Logf: logf}))
+	}
+	if dup := simbus.DuplicateIds(); 0 < len(dup) {
+		fmt.Printf("Duplicate IDs %X, replies will collide\n", dup)
+	}
 
 	serialLink, errLink := sds011.CreateLinuxSerial(*pSerialDevice)
-
 	if errLink != nil {
 		fmt.Printf("SERIAL LINK FAIL %v\n", errLink.Error())
 		return
 	}
 
-	//One sensor simple sim :)
-	go func() { //HACK, single sensor
-		for {
-			simsensor.Model = <-modelUpdates
-		}
-	}()
+	errAttach := simbus.Attach(serialLink)
+	if errAttach != nil {
+		fmt.Printf("SIMULATOR FAIL %v\n", errAttach.Error())
+		return
+	}
 
 	go func() {
-		for {
-			bytArr := <-simsensor.Output
-
-			color.Set(color.FgCyan)
-			fmt.Printf("to serial : %#X\n", bytArr)
-			color.Unset()
-
-			errWrite := serialLink.SendBytes(bytArr) //Using sendBytes
-			//n, errWrite := serialLink.Serialport.Write(bytArr) //Should write all in one pass
-			if errWrite != nil {
-				fmt.Printf("Error writing %v\n", errWrite.Error())
-			}
-		}
-	}()
-
-	go func() { //allows to capture and print debug here :)
-		for {
-			msg, errMsg := serialLink.Recieve()
-			if errMsg != nil {
-				fmt.Printf("ERR RECIEVING %s\n", errMsg)
-				os.Exit(-1)
-			}
-			if msg != nil {
-				//msg := <-packetsToSensor //serialLink.Recieving
-				color.Set(color.FgGreen)
-				fmt.Printf("Recieved request %s (write to %v/%v)\n", msg, len(simsensor.Input), cap(simsensor.Input))
-				color.Unset()
-
-				simsensor.Input <- *msg
-			}
-		}
+		errSim := <-simbus.Errors
+		fmt.Printf("ERR ON SERIAL %s\n", errSim)
+		os.Exit(-1)
 	}()
-
-	/*
-		go func() {
-			serialRunErr := serialLink.Run()
-			if serialRunErr != nil {
-				fmt.Printf("SERIAL LINK FAIL %v\n", serialRunErr.Error())
-			} else {
-				fmt.Printf("Serial link failed without any explanation\n")
+	for _, simsensor := range simbus.Sensors() {
+		go func(simsensor *sim.SimSensor) {
+			for {
+				mod := <-simsensor.ModelChanges
+				fmt.Printf("TODO SAVE MODEL UPDATED BY SERIAL %#v\n", mod)
 			}
-			os.Exit(-1)
-		}()*/
-
-	modelUpdateBySerial := make(chan SensorModel, 3)
-	modelUpdateBySerial <- simsensor.Model
-	go simsensor.Run(statusChanges, modelUpdateBySerial)
+		}(simsensor)
+	}
 
-	errRun := runSingleSensorHttpsServer(modelUpdateBySerial, modelUpdates, statusChanges, *pUiport, *pHttpsCrt, *pHttpsKey)
+	errRun := runHttpsServer(simbus, *pUiport, *pHttpsCrt, *pHttpsKey)
 	fmt.Printf("UI server failed %v\n", errRun.Error())
-
 }
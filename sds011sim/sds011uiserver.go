@@ -5,71 +5,88 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/hjkoskel/sds011/sim"
 )
 
-//var modelledSensors []SimSensor
-
-// Single sensor server
-func runSingleSensorHttpsServer(
-	modelUpdatedBySerial chan SensorModel, modelUpdatedByUser chan SensorModel, simStatusUpdating chan SensorModelStatus,
-	uiport int, httpsCrt string, httpsKey string) error {
-	modelNow := <-modelUpdatedBySerial //Initial is needed for reason that channel direction must not change
-
-	go func() {
-		for {
-			modelNow = <-modelUpdatedBySerial
-			fmt.Printf("TODO MODEL UPDATED TO %#v\n", modelNow)
-		}
-	}()
-
-	fmt.Printf("\n\nStarting server with %#v\n", modelNow)
+// Sensor on bus, listed by /sensors
+type sensorEntry struct {
+	Index int    `json:"index"` //Position on bus, select sensor with this
+	Id    uint16 `json:"id"`    //Not unique if bus have duplicate IDs
+}
 
-	sensorStatusNow := SensorModelStatus{}
-	go func() {
-		for {
-			sensorStatusNow = <-simStatusUpdating // simStatusUpdating
-		}
-	}()
+// Sensor selected by ?n= parameter, index on bus. IDs can be duplicated so those are not used. First sensor if not given
+func selectSensor(simbus *sim.SimBus, r *http.Request) (*sim.SimSensor, error) {
+	sensors := simbus.Sensors()
+	indexString := r.URL.Query().Get("n")
+	if indexString == "" {
+		indexString = "0"
+	}
+	index, errParse := strconv.Atoi(indexString)
+	if errParse != nil {
+		return nil, fmt.Errorf("invalid sensor index %v", indexString)
+	}
+	if index < 0 || len(sensors) <= index {
+		return nil, fmt.Errorf("no sensor at index %v, bus have %v sensors", index, len(sensors))
+	}
+	return sensors[index], nil
+}
 
+// Serves UI for all sensors on bus
+func runHttpsServer(simbus *sim.SimBus, uiport int, httpsCrt string, httpsKey string) error {
 	fs := http.FileServer(http.Dir("simui"))
 
 	r := mux.NewRouter()
 
+	r.HandleFunc("/sensors", func(w http.ResponseWriter, r *http.Request) {
+		entries := []sensorEntry{}
+		for i, simsensor := range simbus.Sensors() {
+			entries = append(entries, sensorEntry{Index: i, Id: simsensor.Model().SensorMem.Id})
+		}
+		b, _ := json.Marshal(entries)
+		w.Write(b)
+	})
+
 	r.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		//fmt.Printf("TODO HANDLE STATUS QUERY")
-		b, _ := json.Marshal(sensorStatusNow)
+		simsensor, errSelect := selectSensor(simbus, r)
+		if errSelect != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(errSelect.Error()))
+			return
+		}
+		b, _ := json.Marshal(simsensor.Status())
 		w.Write(b)
 	})
 
 	r.HandleFunc("/model", func(w http.ResponseWriter, r *http.Request) {
-		//fmt.Printf("HANDLING QUERY %v\n", r.Method)
+		simsensor, errSelect := selectSensor(simbus, r)
+		if errSelect != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(errSelect.Error()))
+			return
+		}
 		if r.Method == "POST" {
 			postbody, errRead := io.ReadAll(r.Body)
 			if errRead != nil {
-				w.Write([]byte(fmt.Sprintf("Reading POST request failed %v", errRead.Error())))
 				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(fmt.Sprintf("Reading POST request failed %v", errRead.Error())))
 				return
 			}
-			mod := SensorModel{}
+			mod := sim.SensorModel{}
 			errMarsh := json.Unmarshal(postbody, &mod)
 			if errMarsh != nil {
-				w.Write([]byte(fmt.Sprintf("Invalid payload %v", errMarsh.Error())))
 				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(fmt.Sprintf("Invalid payload %v", errMarsh.Error())))
 				return
 			}
 			fmt.Printf("updating model to %#v\n", mod)
-			if len(modelUpdatedByUser) < cap(modelUpdatedByUser) { //TODO VALIDITY CHECK HERE.. RETURN ERROR IF ID is in use
-				modelUpdatedByUser <- mod
-				modelNow = mod
-			} else {
-				fmt.Printf("MODEL UPDATE KANAVA TUKOSSA\n")
-			}
+			simsensor.SetModel(mod)
 		}
 
 		//Report response
-		b, _ := json.Marshal(modelNow)
+		b, _ := json.Marshal(simsensor.Model())
 		w.Write(b)
 	})
 
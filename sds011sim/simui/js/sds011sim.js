@@ -8,6 +8,8 @@ Main module
 API:
 /model  POST sets... initial get is needed
 /status, stupid poll
+/sensors, list of {index,id} on bus
+Sensor is selected with ?n= parameter (index on bus), same as on page url. IDs can be duplicated
 
 */
 
@@ -40,9 +42,21 @@ function httpPostAsync(theUrl,payloadobject, callback){
 
 var elementSingleSensor=document.querySelector("#singleSensor")
 
+let sensorIndex=new URLSearchParams(window.location.search).get("n")
+let idQuery=sensorIndex ? "?n="+sensorIndex : ""
+
+function updateSensorList(entries){
+  let list=document.querySelector("#sensorList")
+  list.innerHTML=entries.map(entry => {
+    let hex=entry.id.toString(16).toUpperCase()
+    return `<a href="?n=${entry.index}">${entry.index}:${hex}</a>`
+  }).join(" ")
+}
+httpGetAsync("/sensors",updateSensorList)
+
 elementSingleSensor.addEventListener('userInput', e => {
   console.log("SENSOR SETTINGS CHANGED "+JSON.stringify(e.detail))
-  httpPostAsync("/model",e.detail, updateModelOnUI)
+  httpPostAsync("/model"+idQuery,e.detail, updateModelOnUI)
 })
 
 function updateStatusToUI(newStatus){
@@ -60,8 +74,8 @@ function updateModelOnUI(newModel){ //Read back etc
 
 //TODO Websockets... too lazy for just dev tool lets poll
 setInterval(function(){
-  httpGetAsync("/status",updateStatusToUI)
+  httpGetAsync("/status"+idQuery,updateStatusToUI)
   //FUCK DIRTY CHECK :D :D  if(!simSettingsUpdated){
-    httpGetAsync("/model",updateModelOnUI)
+    httpGetAsync("/model"+idQuery,updateModelOnUI)
   //}
 },1000)
@@ -0,0 +1,92 @@
+//go:build !tinygo
+
+/*
+SerialSupervisor keeps LinuxConn open. For USB-serial adapters that can be unplugged
+
+When link fails, file is closed and opening is retried with exponential backoff (see ReconnectConn).
+Port can be re-resolved by USB serial number, because adapter can come back with different /dev/ttyUSBx name
+*/
+
+package sds011
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hjkoskel/listserialports"
+)
+
+const (
+	LINKCHECKINTERVAL = 1000 //milliseconds, how often device file existence is checked. Unplugged tty might just give EOF
+)
+
+// Implements Conn. Never returns error from Recieve, unless closed
+type SerialSupervisor struct {
+	*ReconnectConn
+	DeviceName string //Used if UsbSerial is not set or not found
+	UsbSerial  string //Optional, find port from /dev/serial/by-id by this
+}
+
+func CreateSerialSupervisor(deviceName string, usbSerial string) *SerialSupervisor {
+	result := &SerialSupervisor{
+		DeviceName: deviceName,
+		UsbSerial:  usbSerial,
+	}
+	result.ReconnectConn = NewReconnectConn(result.open)
+	return result
+}
+
+// Finds device file by usb serial number from /dev/serial/by-id links
+func resolveUsbSerialPort(usbSerial string) (string, error) {
+	byId, errList := listserialports.ListById()
+	if errList != nil {
+		return "", errList
+	}
+	for devFile, idName := range byId {
+		if strings.Contains(idName, usbSerial) {
+			return devFile, nil
+		}
+	}
+	return "", fmt.Errorf("no serial port with usb serial %v", usbSerial)
+}
+
+func (p *SerialSupervisor) open() (Conn, string, error) {
+	port := p.DeviceName
+	if p.UsbSerial != "" {
+		resolved, errResolve := resolveUsbSerialPort(p.UsbSerial)
+		if errResolve == nil {
+			port = resolved
+		} else if port == "" {
+			return nil, "", errResolve
+		}
+	}
+
+	conn, errCreate := CreateLinuxSerial(port)
+	if errCreate != nil {
+		if conn != nil && conn.f != nil {
+			conn.Close()
+		}
+		return nil, port, errCreate
+	}
+	return &checkedSerial{LinuxConn: conn, port: port, tLastCheck: time.Now()}, port, nil
+}
+
+// LinuxConn that checks device file is still there
+type checkedSerial struct {
+	*LinuxConn
+	port       string
+	tLastCheck time.Time
+}
+
+func (p *checkedSerial) Recieve() (*Packet, error) {
+	if time.Millisecond*LINKCHECKINTERVAL < time.Since(p.tLastCheck) {
+		p.tLastCheck = time.Now()
+		_, errStat := os.Stat(p.port)
+		if errStat != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDisconnected, errStat)
+		}
+	}
+	return p.LinuxConn.Recieve()
+}
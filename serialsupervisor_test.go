@@ -0,0 +1,99 @@
+//go:build !tinygo
+
+package sds011
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSerialSupervisorReconnect(t *testing.T) {
+	sup := CreateSerialSupervisor("/dev/ttyFAKE", "")
+	sup.Backoff = Backoff{Min: 50 * time.Millisecond, Max: time.Second}
+	var onConnects int32
+	sup.OnConnect = func() error {
+		atomic.AddInt32(&onConnects, 1)
+		return nil
+	}
+
+	var mu sync.Mutex
+	peers := make(chan *PipeConn, 3)
+	tOpens := []time.Time{}
+	nOpen := 0
+	sup.ReconnectConn.open = func() (Conn, string, error) { //Second open fails, like adapter still missing
+		mu.Lock()
+		defer mu.Unlock()
+		tOpens = append(tOpens, time.Now())
+		nOpen++
+		if nOpen == 2 {
+			return nil, "/dev/ttyFAKE", errors.New("no such device")
+		}
+		local, peer := NewPipeConnPair()
+		peers <- peer
+		return local, "/dev/ttyFAKE", nil
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			sup.Recieve()
+		}
+	}()
+
+	nextEvent := func(connected bool) LinkEvent {
+		t.Helper()
+		select {
+		case ev := <-sup.Events:
+			if ev.Connected != connected || ev.Port != "/dev/ttyFAKE" {
+				t.Fatalf("unexpected event %v", ev)
+			}
+			return ev
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no event, expected connected=%v", connected)
+		}
+		return LinkEvent{}
+	}
+
+	nextEvent(true)
+	peer := <-peers
+	peer.Close() //Unplugged
+	evLost := nextEvent(false)
+	if !errors.Is(evLost.Err, ErrDisconnected) {
+		t.Errorf("disconnect reason %v", evLost.Err)
+	}
+	nextEvent(false) //Failed try
+	nextEvent(true)
+	<-peers
+
+	mu.Lock()
+	if len(tOpens) != 3 {
+		t.Fatalf("%v opens, expected 3", len(tOpens))
+	}
+	if gap := tOpens[1].Sub(evLost.Time); gap < 50*time.Millisecond-5*time.Millisecond {
+		t.Errorf("first retry after %v, backoff is 50ms", gap)
+	}
+	if gap := tOpens[2].Sub(tOpens[1]); gap < 100*time.Millisecond-5*time.Millisecond {
+		t.Errorf("second retry after %v, backoff should double to 100ms", gap)
+	}
+	mu.Unlock()
+	if !sup.Connected() {
+		t.Errorf("not connected")
+	}
+	if n := atomic.LoadInt32(&onConnects); n != 2 {
+		t.Errorf("OnConnect called %v times, expected 2", n)
+	}
+
+	sup.Close()
+	if _, err := sup.Recieve(); err == nil {
+		t.Errorf("closed supervisor did not return error")
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Sensor model
+
+Sensor model state is loaded from disk and manipulated by user while running
+This models single sensor
+
+It is important to notice that simulated sensor recieves all messages "ok".
+It just acts as faulty sensor (or comm link) when needed.
+
+*/
+
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/hjkoskel/sds011"
+)
+
+// Separate settings and status
+type SensorModelStatus struct {
+	Working            bool   `json:"working"`            //- working or sleep (depend on period and last time)
+	MeasurementCounter int    `json:"measurementCounter"` //- measurement counter (for sim)
+	RxPacketCounter    int    `json:"rxPacketCounter"`    //- packet counters
+	TxPacketCounter    int    `json:"txPacketCounter"`    //- packet counters
+	SmallRegNow        uint16 `json:"smallRegNow"`        //Update these. Report by time or by clock
+	LargeRegNow        uint16 `json:"largeRegNow"`
+	BurnEventCounter   int    `json:"burnEventCounter"` //How many persistent save events happened
+}
+
+type SensorModel struct {
+	SensorMem      SensorMemory      `json:"sensorMem"`
+	PowerOn        bool              `json:"powerOn"` //- is powered up (toggling this allows to do "power reset")
+	SmallParticles SignalModel       `json:"smallParticles"`
+	LargeParticles SignalModel       `json:"largeParticles"`
+	Connectivity   ConnectivityModel `json:"connectivity"` //Allow simulate communication conditions
+}
+
+type ConnectivityModel struct {
+	RxConnected         bool `json:"rxConnected"`         //- rx line connected ( computer-> sensor)  RX not connected. Sensor do not react :D
+	TxConnected         bool `json:"txConnected"`         //- tx line connected (sensor -> computer).
+	ShortCircuit        bool `json:"shortCircuit"`        //rx and tx lines are connected together ERROR MODE
+	DirectionChangeNull bool `json:"directionChangeNull"` //RS485 artefact. when recieve/transit changes there is null character
+	IncompletePackages  bool `json:"incompletePackages"`  //Not all bytes are coming
+	InvalidCRC          bool `json:"invalidCRC"`          //Wrong CRC, easy test
+	IdleCharacters      bool `json:"idleCharacters"`      //Random line noise in between packets
+}
+
+type SignalModel struct { //Works as floats.. registers report as 10*
+	Noise     float64 `json:"noise"` //in range [value-noise, value+noise]
+	Offset    float64 `json:"offset"`
+	Period    int64   `json:"period"`    //In milliseconds, sine period
+	Phase     int64   `json:"phase"`     //In milliseconds.
+	Amplitude float64 `json:"amplitude"` // offset-amplitude to offset+amplitude
+}
+
+type SensorMemory struct {
+	Id           uint16 `json:"id"`
+	VersionYear  byte   `json:"year"` // - Version:  year,month,day
+	VersionMonth byte   `json:"month"`
+	VersionDay   byte   `json:"day"`
+	Period       byte   `json:"period"`
+	QueryMode    bool   `json:"queryMode"`
+}
+
+// Model of healthy sensor with given id, working in active mode
+func DefaultModel(id uint16) SensorModel {
+	return SensorModel{
+		SensorMem:    SensorMemory{Id: id, VersionYear: 19, VersionMonth: 9, VersionDay: 28, Period: 0, QueryMode: false},
+		PowerOn:      true,
+		Connectivity: ConnectivityModel{RxConnected: true, TxConnected: true},
+	}
+}
+
+func (p *SignalModel) Calc(t time.Time) float64 {
+	ms := t.UnixNano() / (1000 * 1000)
+	wave := 0.0
+	if p.Period != 0 {
+		angle := 2.0 * math.Pi * math.Mod(float64(ms+p.Phase), float64(p.Period)) / float64(p.Period)
+		wave = math.Sin(angle) * p.Amplitude
+	}
+	return math.Max(0, (rand.Float64()*2.0-1.0)*p.Noise+wave+p.Offset)
+}
+
+// Trash signal only if needed
+func (p *ConnectivityModel) TrashSignal(pack sds011.Packet) []byte {
+	arr := pack.ToBytes()
+	if p.InvalidCRC {
+		arr[len(arr)-2] += 1
+	}
+
+	if p.DirectionChangeNull {
+		arr = append([]byte{0}, arr...)
+		arr = append(arr, 0)
+	}
+	if p.IncompletePackages { //Cut away from end reciever might keep waiting?
+		arr = arr[0 : len(arr)-4]
+	}
+	return arr
+}
@@ -0,0 +1,314 @@
+/*
+Simulated SDS011 sensor
+
+SimSensor reacts to commands like real sensor, produces measurements from
+SignalModel and can act as faulty sensor or comm link (see ConnectivityModel).
+Attach it to any Conn that can send raw bytes (LinuxConn, StreamConn, PipeConn)
+*/
+
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/hjkoskel/sds011"
+)
+
+const (
+	INTERVALIDLECHARS = 1500 //milliseconds between junk bytes when IdleCharacters is on
+	SIMTICK           = 50   //milliseconds, timing resolution of simulation
+	SIMOUTPUTQUEUE    = 10   //Byte bursts waiting for line
+)
+
+// Conn used by simulator must allow sending trashed bytes
+type ByteSender interface {
+	SendBytes(data []byte) error
+}
+
+type Options struct {
+	Model *SensorModel                          //Initial model, nil gives DefaultModel
+	Logf  func(format string, a ...interface{}) //Debug printout, nil is silent
+}
+
+type SimSensor struct {
+	ModelChanges chan SensorModel //Sensor memory written over serial (id, period, query mode). Persist these
+	Errors       chan error       //Link failures from attached conn
+
+	mu        sync.Mutex
+	model     SensorModel //This is loaded, changed...stored etc..
+	status    SensorModelStatus
+	tPrevMeas time.Time
+	tTrash    time.Time
+
+	out      chan []byte //Writes out burst of bytes
+	logf     func(format string, a ...interface{})
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func New(id uint16, opts Options) *SimSensor {
+	result := SimSensor{
+		ModelChanges: make(chan SensorModel, 3),
+		Errors:       make(chan error, 3),
+		model:        DefaultModel(id),
+		tPrevMeas:    time.Unix(0, 0), //First measurement right after start
+		tTrash:       time.Now(),
+		out:          make(chan []byte, SIMOUTPUTQUEUE),
+		logf:         opts.Logf,
+		stop:         make(chan struct{}),
+	}
+	if opts.Model != nil {
+		result.model = *opts.Model
+	}
+	if result.logf == nil {
+		result.logf = func(format string, a ...interface{}) {}
+	}
+	return &result
+}
+
+func (p *SimSensor) Model() SensorModel {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.model
+}
+
+// User changes model while running. Like disconnecting wires or changing particle levels
+func (p *SimSensor) SetModel(model SensorModel) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.model = model
+}
+
+func (p *SimSensor) Status() SensorModelStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// Attach starts simulation on conn. Stop before closing conn. Use SimBus for multiple sensors on same conn
+func (p *SimSensor) Attach(conn sds011.Conn) error {
+	sender, ok := conn.(ByteSender)
+	if !ok {
+		return fmt.Errorf("conn %T can not send raw bytes", conn)
+	}
+	p.start()
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case arr := <-p.out:
+				errWrite := sender.SendBytes(arr)
+				if errWrite != nil {
+					p.reportError(fmt.Errorf("writing %w", errWrite))
+				}
+			}
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		errRecieve := recieveLoop(conn, p.stop, p.logf, p.react)
+		if errRecieve != nil {
+			p.reportError(errRecieve)
+		}
+	}()
+	return nil
+}
+
+// Starts measurement timing
+func (p *SimSensor) start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.runTiming()
+	}()
+}
+
+// Reads conn until stopped or link fails
+func recieveLoop(conn sds011.Conn, stop chan struct{}, logf func(format string, a ...interface{}), react func(sds011.Packet)) error {
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		pack, errRecieve := conn.Recieve()
+		if errRecieve != nil {
+			if sds011.IsRecoverable(errRecieve) {
+				continue
+			}
+			return errRecieve
+		}
+		if pack != nil {
+			logf("recieved request %s\n", pack)
+			react(*pack)
+		}
+	}
+}
+
+// Stop simulation. Returns after pending Recieve call on conn returns
+func (p *SimSensor) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.wg.Wait()
+}
+
+func (p *SimSensor) reportError(err error) {
+	select {
+	case p.Errors <- err:
+	default:
+	}
+}
+
+// Must hold mu
+func (p *SimSensor) outputLocked(arr []byte) {
+	select {
+	case p.out <- arr:
+	default:
+		p.logf("output queue full, dropped %X\n", arr)
+	}
+}
+
+// Must hold mu. Sends package based on ConnectivityModel
+func (p *SimSensor) transmitLocked(pack sds011.Packet) {
+	p.outputLocked(p.model.Connectivity.TrashSignal(pack))
+	p.status.TxPacketCounter++
+}
+
+func (p *SimSensor) runTiming() {
+	ticker := time.NewTicker(time.Millisecond * SIMTICK)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case tNow := <-ticker.C:
+			p.tick(tNow)
+		}
+	}
+}
+
+// Measurement and line noise timing
+func (p *SimSensor) tick(tNow time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.model.Connectivity.IdleCharacters && (time.Millisecond*INTERVALIDLECHARS) < tNow.Sub(p.tTrash) {
+		junk := make([]byte, 9)
+		for i := range junk {
+			junk[i] = byte(rand.Uint32() & 0xFF)
+		}
+		p.outputLocked(junk)
+		p.tTrash = tNow
+	}
+
+	per := time.Duration(p.model.SensorMem.Period) * time.Minute
+	if per == 0 {
+		per = 30 * time.Second
+	}
+	since := tNow.Sub(p.tPrevMeas)
+	p.status.Working = per-since <= 30*time.Second //30sec before result put fan on
+	if since < per {
+		return
+	}
+	p.status.SmallRegNow = uint16(p.model.SmallParticles.Calc(tNow) * 10)
+	p.status.LargeRegNow = uint16(p.model.LargeParticles.Calc(tNow) * 10)
+	p.status.MeasurementCounter++
+	p.tPrevMeas = tNow
+	p.logf("modelling small=%v large=%v\n", p.status.SmallRegNow, p.status.LargeRegNow)
+
+	if !p.model.SensorMem.QueryMode {
+		p.transmitLocked(sds011.NewPacket_DataReply(p.model.SensorMem.Id, p.status.SmallRegNow, p.status.LargeRegNow))
+	}
+}
+
+// Reacts to input
+func (p *SimSensor) react(inp sds011.Packet) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.RxPacketCounter++
+	if !p.model.Connectivity.RxConnected {
+		return
+	}
+	if p.model.Connectivity.ShortCircuit {
+		p.outputLocked(inp.ToBytes()) //Immediately report same back as fast wires would :D
+		return
+	}
+	if !inp.MatchToId(p.model.SensorMem.Id) {
+		p.logf("packet ID=%X, no match to simulator %X\n", inp.DeviceID, p.model.SensorMem.Id)
+		return
+	}
+	respPack, respErr := p.reactToPackage(inp)
+	if respErr != nil {
+		p.logf("ERROR %v\n", respErr)
+		return
+	}
+	p.logf("giving response %s\n", respPack)
+	p.transmitLocked(respPack)
+}
+
+// Must hold mu. Sensor memory was written
+func (p *SimSensor) burnLocked() {
+	p.status.BurnEventCounter++ //Important to count memory wear out
+	select {
+	case p.ModelChanges <- p.model:
+	default:
+	}
+}
+
+// Must hold mu
+func (p *SimSensor) reactToPackage(pack sds011.Packet) (sds011.Packet, error) {
+	if !pack.Valid { //Maybe this is tested in somewhere else beforehand
+		return sds011.Packet{}, fmt.Errorf("invalid packet")
+	}
+	if pack.CommandID != sds011.COMMANDID_CMD {
+		return sds011.Packet{}, fmt.Errorf("simulator understands only commandId=0xB4")
+	}
+
+	write := pack.GetIsWrite()
+	switch pack.Data[0] {
+	case sds011.FUNNUMBER_REPORTINGMODE:
+		if write {
+			p.model.SensorMem.QueryMode, _ = pack.GetQueryMode()
+			p.burnLocked()
+		}
+		return sds011.NewPacket_SetQueryModeReply(p.model.SensorMem.Id, write, p.model.SensorMem.QueryMode), nil
+	case sds011.FUNNUMBER_QUERYDATA:
+		return sds011.NewPacket_DataReply(p.model.SensorMem.Id, p.status.SmallRegNow, p.status.LargeRegNow), nil
+	case sds011.FUNNUMBER_SETID:
+		if write {
+			id, idErr := pack.GetSetId()
+			if idErr != nil {
+				return sds011.Packet{}, idErr
+			}
+			p.model.SensorMem.Id = id
+			p.burnLocked()
+		}
+		return sds011.NewPacket_SetIdReply(p.model.SensorMem.Id), nil
+	case sds011.FUNNUMBER_SLEEPWORK:
+		if write {
+			p.status.Working, _ = pack.GetWorkMode() //Measurement timing changes it back
+			p.logf("work mode set to %v\n", p.status.Working)
+		}
+		return sds011.NewPacket_SetWorkModeReply(p.model.SensorMem.Id, write, p.status.Working), nil
+	case sds011.FUNNUMBER_PERIOD:
+		if write {
+			per, errPeriod := pack.GetPeriod() //TODO limit check
+			if errPeriod != nil {
+				return sds011.Packet{}, errPeriod
+			}
+			p.model.SensorMem.Period = per
+			p.burnLocked()
+		}
+		return sds011.NewPacket_SetPeriodReply(p.model.SensorMem.Id, write, p.model.SensorMem.Period), nil
+	case sds011.FUNNUMBER_VERSION:
+		return sds011.NewPacket_QueryVersionReply(p.model.SensorMem.Id, p.model.SensorMem.VersionYear, p.model.SensorMem.VersionMonth, p.model.SensorMem.VersionDay), nil
+	}
+
+	return sds011.Packet{}, fmt.Errorf("invalid function %v", pack.Data[0])
+}
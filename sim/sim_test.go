@@ -0,0 +1,130 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/sds011"
+)
+
+func startSim(t *testing.T, model SensorModel) (*SimSensor, *sds011.PipeConn) {
+	hostEnd, simEnd := sds011.NewPipeConnPair()
+	s := New(model.SensorMem.Id, Options{Model: &model, Logf: t.Logf})
+	if err := s.Attach(simEnd); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Stop()
+		hostEnd.Close()
+	})
+	return s, hostEnd
+}
+
+func TestSignalModelCalc(t *testing.T) {
+	t0 := time.UnixMilli(0)
+	flat := SignalModel{Offset: 5}
+	if v := flat.Calc(t0); v != 5 {
+		t.Errorf("zero noise gave %v, expected offset 5", v)
+	}
+
+	noisy := SignalModel{Offset: 5, Noise: 2}
+	low, high := 5.0, 5.0
+	for i := 0; i < 1000; i++ {
+		v := noisy.Calc(t0)
+		low, high = min(low, v), max(high, v)
+	}
+	if low < 3 || 7 < high || 4 < low || high < 6 {
+		t.Errorf("noise range [%v, %v], expected to cover most of [3, 7]", low, high)
+	}
+
+	wave := SignalModel{Offset: 5, Amplitude: 2, Period: 1000}
+	for _, tc := range []struct {
+		ms       int64
+		expected float64
+	}{{0, 5}, {250, 7}, {500, 5}, {750, 3}, {1250, 7}} {
+		if v := wave.Calc(time.UnixMilli(tc.ms)); math.Abs(v-tc.expected) > 1e-9 {
+			t.Errorf("sine at %vms gave %v, expected %v", tc.ms, v, tc.expected)
+		}
+	}
+	wave.Phase = 250
+	if v := wave.Calc(t0); math.Abs(v-7) > 1e-9 {
+		t.Errorf("phase 250ms gave %v, expected 7", v)
+	}
+}
+
+func TestSimSensor(t *testing.T) {
+	model := DefaultModel(0xABCD)
+	model.SmallParticles.Offset = 12.3
+	model.LargeParticles.Offset = 45.6
+	s, hostEnd := startSim(t, model)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := make(chan sds011.Result, 3)
+	sensor := sds011.InitSds011(0xABCD, false, hostEnd, results, 0)
+	go sensor.Run(ctx)
+
+	select { //Active mode sensor reports right after start
+	case res := <-results:
+		if res.SmallReg != 123 || res.LargeReg != 456 {
+			t.Errorf("invalid spontanious result %#v", res)
+		}
+	case <-ctx.Done():
+		t.Fatal("no spontanious result")
+	}
+
+	errSet := sensor.SetSettings(ctx, sds011.Sds011Settings{QueryMode: true, Period: 2})
+	if errSet != nil {
+		t.Fatal(errSet)
+	}
+	if mem := s.Model().SensorMem; !mem.QueryMode || mem.Period != 2 {
+		t.Errorf("settings not written to sensor memory %#v", mem)
+	}
+	if st := s.Status(); st.BurnEventCounter != 2 {
+		t.Errorf("burn events %v, expected 2", st.BurnEventCounter)
+	}
+	select {
+	case changed := <-s.ModelChanges:
+		if changed.SensorMem.Period != 2 {
+			t.Errorf("first change should be period %#v", changed.SensorMem)
+		}
+	default:
+		t.Errorf("model change not reported")
+	}
+
+	res, errQuery := sensor.QueryMeasurement(ctx)
+	if errQuery != nil {
+		t.Fatal(errQuery)
+	}
+	if res.SmallReg != 123 || res.LargeReg != 456 {
+		t.Errorf("invalid queried result %#v", res)
+	}
+
+}
+
+func TestSimSensorDisconnectedRx(t *testing.T) {
+	model := DefaultModel(0xABCD)
+	model.SensorMem.QueryMode = true
+	model.Connectivity.RxConnected = false
+	s, hostEnd := startSim(t, model)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sensor := sds011.InitSds011(0xABCD, false, hostEnd, make(chan sds011.Result, 3), 0)
+	go sensor.Run(ctx)
+
+	if _, err := sensor.QueryMeasurement(ctx); !errors.Is(err, sds011.ErrTimeout) {
+		t.Errorf("expected timeout, got %v", err)
+	}
+	model.Connectivity.RxConnected = true
+	s.SetModel(model)
+	if _, err := sensor.QueryMeasurement(ctx); err != nil {
+		t.Errorf("reconnected rx err=%v", err)
+	}
+	if st := s.Status(); st.TxPacketCounter != 1 {
+		t.Errorf("unexpected packet counters %#v", st)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Multiple simulated sensors on same serial port (like RS485 bus)
+
+Each sensor have own model, ID and faults. All sensors hear every request.
+Replies sent at same time collide on wire. That happens with broadcast (ANYDEVICE) requests and with duplicate IDs
+*/
+
+package sim
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hjkoskel/sds011"
+)
+
+const (
+	COLLISIONWINDOW = 10 //milliseconds, transmissions starting inside this window overlap. One frame at 9600 baud
+)
+
+type CollisionMode int
+
+const (
+	COLLISION_INTERLEAVE CollisionMode = iota //Bytes of overlapping transmissions are mixed one by one
+	COLLISION_GARBLE                          //Overlapping bytes are ANDed, like dominant zero on line
+	COLLISION_NONE                            //Ideal line, transmissions are sent one after another
+)
+
+func (p CollisionMode) String() string {
+	switch p {
+	case COLLISION_INTERLEAVE:
+		return "interleave"
+	case COLLISION_GARBLE:
+		return "garble"
+	case COLLISION_NONE:
+		return "none"
+	}
+	return fmt.Sprintf("collision mode %d", int(p))
+}
+
+func ParseCollisionMode(s string) (CollisionMode, error) {
+	for _, mode := range []CollisionMode{COLLISION_INTERLEAVE, COLLISION_GARBLE, COLLISION_NONE} {
+		if mode.String() == s {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown collision mode %v", s)
+}
+
+// Burst of bytes from one sensor
+type transmission struct {
+	src  *SimSensor
+	data []byte
+}
+
+type SimBus struct {
+	Collision CollisionMode
+	Errors    chan error //Link failures from attached conn
+
+	mu         sync.Mutex
+	sensors    []*SimSensor
+	collisions int
+
+	line     chan transmission
+	logf     func(format string, a ...interface{})
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewSimBus(collision CollisionMode, logf func(format string, a ...interface{})) *SimBus {
+	if logf == nil {
+		logf = func(format string, a ...interface{}) {}
+	}
+	return &SimBus{
+		Collision: collision,
+		Errors:    make(chan error, 3),
+		sensors:   []*SimSensor{},
+		line:      make(chan transmission, SIMOUTPUTQUEUE),
+		logf:      logf,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Add sensor on bus. Must be called before Attach
+func (p *SimBus) Add(sensor *SimSensor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sensors = append(p.sensors, sensor)
+}
+
+func (p *SimBus) Sensors() []*SimSensor {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*SimSensor{}, p.sensors...)
+}
+
+// IDs used by more than one sensor. Those replies always collide
+func (p *SimBus) DuplicateIds() []uint16 {
+	count := make(map[uint16]int)
+	result := []uint16{}
+	for _, sensor := range p.Sensors() {
+		id := sensor.Model().SensorMem.Id
+		count[id]++
+		if count[id] == 2 {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// How many times transmissions have overlapped
+func (p *SimBus) Collisions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.collisions
+}
+
+func (p *SimBus) reportError(err error) {
+	select {
+	case p.Errors <- err:
+	default:
+	}
+}
+
+// Attach starts all sensors on conn. Stop before closing conn
+func (p *SimBus) Attach(conn sds011.Conn) error {
+	sender, ok := conn.(ByteSender)
+	if !ok {
+		return fmt.Errorf("conn %T can not send raw bytes", conn)
+	}
+	sensors := p.Sensors()
+	for _, sensor := range sensors {
+		sensor.start()
+		p.wg.Add(1)
+		go func(sensor *SimSensor) { //Sensor output goes to shared line
+			defer p.wg.Done()
+			for {
+				select {
+				case <-p.stop:
+					return
+				case arr := <-sensor.out:
+					select {
+					case p.line <- transmission{src: sensor, data: arr}:
+					case <-p.stop:
+						return
+					}
+				}
+			}
+		}(sensor)
+	}
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		p.runLine(sender)
+	}()
+	go func() {
+		defer p.wg.Done()
+		errRecieve := recieveLoop(conn, p.stop, p.logf, func(pack sds011.Packet) {
+			for _, sensor := range sensors {
+				sensor.react(pack)
+			}
+		})
+		if errRecieve != nil {
+			p.reportError(errRecieve)
+		}
+	}()
+	return nil
+}
+
+// Stop bus and all sensors on it. Returns after pending Recieve call on conn returns
+func (p *SimBus) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+	for _, sensor := range p.Sensors() {
+		sensor.Stop()
+	}
+	p.wg.Wait()
+}
+
+// Collects overlapping transmissions and writes what would be seen on wire
+func (p *SimBus) runLine(sender ByteSender) {
+	for {
+		var first transmission
+		select {
+		case <-p.stop:
+			return
+		case first = <-p.line:
+		}
+		overlapping := []transmission{first}
+		window := time.NewTimer(time.Millisecond * COLLISIONWINDOW)
+	collect:
+		for {
+			select {
+			case <-p.stop:
+				window.Stop()
+				return
+			case tr := <-p.line:
+				overlapping = append(overlapping, tr)
+			case <-window.C:
+				break collect
+			}
+		}
+
+		for _, arr := range p.collide(overlapping) {
+			errWrite := sender.SendBytes(arr)
+			if errWrite != nil {
+				p.reportError(fmt.Errorf("writing %w", errWrite))
+			}
+		}
+	}
+}
+
+// Transmissions from same sensor are sequential, different sensors overlap
+func (p *SimBus) collide(overlapping []transmission) [][]byte {
+	bySensor := [][]byte{}
+	index := make(map[*SimSensor]int)
+	for _, tr := range overlapping {
+		i, found := index[tr.src]
+		if !found {
+			i = len(bySensor)
+			index[tr.src] = i
+			bySensor = append(bySensor, nil)
+		}
+		bySensor[i] = append(bySensor[i], tr.data...)
+	}
+	if len(bySensor) < 2 || p.Collision == COLLISION_NONE {
+		return bySensor
+	}
+
+	p.mu.Lock()
+	p.collisions++
+	p.mu.Unlock()
+	result := collideBytes(p.Collision, bySensor)
+	p.logf("collision of %v transmissions, on wire %X\n", len(bySensor), result)
+	return [][]byte{result}
+}
+
+func collideBytes(mode CollisionMode, transmissions [][]byte) []byte {
+	longest := 0
+	for _, arr := range transmissions {
+		longest = max(longest, len(arr))
+	}
+	result := make([]byte, 0, longest*len(transmissions))
+	for i := 0; i < longest; i++ {
+		if mode == COLLISION_GARBLE {
+			b := byte(0xFF)
+			for _, arr := range transmissions {
+				if i < len(arr) {
+					b &= arr[i]
+				}
+			}
+			result = append(result, b)
+			continue
+		}
+		for _, arr := range transmissions {
+			if i < len(arr) {
+				result = append(result, arr[i])
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,92 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hjkoskel/sds011"
+)
+
+func TestCollideBytes(t *testing.T) {
+	a := []byte{0xAA, 0xC5, 0x0F}
+	b := []byte{0xAA, 0x3C}
+	if got := collideBytes(COLLISION_INTERLEAVE, [][]byte{a, b}); !bytes.Equal(got, []byte{0xAA, 0xAA, 0xC5, 0x3C, 0x0F}) {
+		t.Errorf("interleave gave %X", got)
+	}
+	if got := collideBytes(COLLISION_GARBLE, [][]byte{a, b}); !bytes.Equal(got, []byte{0xAA, 0x04, 0x0F}) {
+		t.Errorf("garble gave %X", got)
+	}
+}
+
+func startSimBus(t *testing.T, collision CollisionMode, ids ...uint16) (*SimBus, *sds011.Bus) {
+	hostEnd, simEnd := sds011.NewPipeConnPair()
+	simBus := NewSimBus(collision, t.Logf)
+	for _, id := range ids {
+		model := DefaultModel(id)
+		model.SensorMem.QueryMode = true //No spontanious data
+		simBus.Add(New(id, Options{Model: &model}))
+	}
+	if err := simBus.Attach(simEnd); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := sds011.NewBus(hostEnd)
+	go bus.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		simBus.Stop()
+		hostEnd.Close()
+	})
+	return simBus, bus
+}
+
+func TestSimBusDiscover(t *testing.T) {
+	simBus, bus := startSimBus(t, COLLISION_NONE, 0xA160, 0xA161)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	found, err := bus.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].ID != 0xA160 || found[1].ID != 0xA161 || !found[0].QueryMode {
+		t.Errorf("unexpected discovery result %v", found)
+	}
+	if simBus.Collisions() != 0 {
+		t.Errorf("ideal line have %v collisions", simBus.Collisions())
+	}
+}
+
+func TestSimBusCollision(t *testing.T) {
+	simBus, bus := startSimBus(t, COLLISION_INTERLEAVE, 0xA160, 0xA161, 0xA161)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if dup := simBus.DuplicateIds(); len(dup) != 1 || dup[0] != 0xA161 {
+		t.Errorf("duplicate ids %X", dup)
+	}
+
+	found, _ := bus.Discover(ctx) //All replies to broadcast are mixed
+	if len(found) != 0 {
+		t.Errorf("sensors found from garbled line %v", found)
+	}
+	if simBus.Collisions() != 1 {
+		t.Errorf("expected one collision, got %v", simBus.Collisions())
+	}
+
+	sensorA := bus.AddSensor(0xA160, false, make(chan sds011.Result, 3), 0)
+	go sensorA.Run(ctx)
+	if _, err := sensorA.QueryMeasurement(ctx); err != nil {
+		t.Errorf("unique id failed %v", err)
+	}
+	sensorB := bus.AddSensor(0xA161, false, make(chan sds011.Result, 3), 0)
+	go sensorB.Run(ctx)
+	if _, err := sensorB.QueryMeasurement(ctx); err == nil {
+		t.Errorf("duplicate id replies did not collide")
+	}
+	if simBus.Collisions() < 2 {
+		t.Errorf("duplicate id reply not counted as collision")
+	}
+}
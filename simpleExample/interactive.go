@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -17,10 +18,12 @@ func printInteractiveHelp() {
 	fmt.Printf("s = send stop command\n")
 	fmt.Printf("z = read work status\n")
 	fmt.Printf("d = query data\n")
+	fmt.Printf("m = query data and wait result\n")
 	fmt.Printf("p = enter period setting\n")
 	fmt.Printf("f = set id as filter\n")
 	fmt.Printf("r = sync settings with sensor\n")
 	fmt.Printf("t = status of settings now\n")
+	fmt.Printf("l = link statistics\n")
 	fmt.Printf("g = report to lib that sensor should be off (use stop, not tested yet)")
 	fmt.Printf("b = report to lib that sensor should be on (use stop, not tested yet)")
 	fmt.Printf("h = print this help\n")
@@ -28,7 +31,7 @@ func printInteractiveHelp() {
 }
 
 // This have colors :)
-func interactiveMode(deviceFile string, devId uint16) error {
+func interactiveMode(ctx context.Context, deviceFile string, devId uint16) error {
 	printInteractiveHelp()
 
 	ser, err := sds011.CreateLinuxSerial(deviceFile)
@@ -44,26 +47,23 @@ func interactiveMode(deviceFile string, devId uint16) error {
 
 	sensorResults := make(chan sds011.Result, 3)
 
-	initialCounter, counterErr := loadMeasurementCounterFromFile()
+	sensor := sds011.InitSds011(uint16(devId), false, ser, sensorResults, 0)
+	counterErr := sensor.UseCounterStore(sds011.FileCounterStore{Dir: ".", LegacyFile: "measuredcounter"}, 0) //Save on every change
 	if counterErr != nil {
 
 		color.Set(color.FgRed)
-		fmt.Printf("Counter error %v, starting from %v\n", counterErr.Error(), initialCounter)
+		fmt.Printf("Counter error %v, starting from %v\n", counterErr.Error(), sensor.MeasurementCounter())
 		color.Unset()
 
 	} else {
-		fmt.Printf("Initial counter value %v\n", initialCounter)
+		fmt.Printf("Initial counter value %v\n", sensor.MeasurementCounter())
 	}
-
-	sensor := sds011.InitSds011(uint16(devId), false, ser, sensorResults, initialCounter)
 	go func() {
 
-		for {
-			runErr := sensor.Run()
-			color.Set(color.FgRed)
-			fmt.Printf("sensor run err %s\n", runErr)
-			color.Unset()
-		}
+		runErr := sensor.Run(ctx)
+		color.Set(color.FgRed)
+		fmt.Printf("sensor run err %s\n", runErr)
+		color.Unset()
 	}()
 	go func() {
 		for {
@@ -71,17 +71,11 @@ func interactiveMode(deviceFile string, devId uint16) error {
 			color.Set(color.FgHiYellow)
 			fmt.Printf("%v Sensor have result %v\n", res.ToString(), time.Now().String())
 			color.Unset()
-			countSaveErr := saveMeasuremntCounterToFile(res.MeasurementCounter)
-			if countSaveErr != nil {
-				color.Set(color.FgHiRed)
-				fmt.Printf("counter save error %v\n", countSaveErr.Error())
-				color.Unset()
-			}
 			fmt.Printf("\n")
 		}
 	}()
 
-	settings, errSettings := sensor.GetSettings()
+	settings, errSettings := sensor.GetSettings(ctx)
 	if errSettings != nil {
 		color.Set(color.FgRed)
 		fmt.Printf("Error getting initial settings: %v\n", errSettings.Error())
@@ -105,7 +99,7 @@ func interactiveMode(deviceFile string, devId uint16) error {
 		case "q":
 			fmt.Printf("switching to QUERY mode\n")
 			settings.QueryMode = true
-			errSettings = sensor.SetSettings(settings) //Not capturing
+			errSettings = sensor.SetSettings(ctx, settings) //Not capturing
 			if errSettings != nil {
 				color.Set(color.FgRed)
 				fmt.Printf("Error getting initial settings: %v\n", errSettings.Error())
@@ -114,7 +108,7 @@ func interactiveMode(deviceFile string, devId uint16) error {
 		case "a":
 			fmt.Printf("switching to ACTIVE mode\n")
 			settings.QueryMode = false
-			errSettings = sensor.SetSettings(settings) //Not capturing
+			errSettings = sensor.SetSettings(ctx, settings) //Not capturing
 			if errSettings != nil {
 				color.Set(color.FgRed)
 				fmt.Printf("Error setting settings: %v\n", errSettings.Error())
@@ -122,7 +116,7 @@ func interactiveMode(deviceFile string, devId uint16) error {
 			}
 		case "w":
 			fmt.Printf("going to work now\n")
-			workErr := sensor.ChangeToWork(true)
+			workErr := sensor.ChangeToWork(ctx, true)
 			if workErr != nil {
 				color.Set(color.FgRed)
 				fmt.Printf("Error setting to work: %v\n", workErr.Error())
@@ -130,7 +124,7 @@ func interactiveMode(deviceFile string, devId uint16) error {
 			}
 		case "s":
 			fmt.Printf("going to stop now\n")
-			workErr := sensor.ChangeToWork(false)
+			workErr := sensor.ChangeToWork(ctx, false)
 			if workErr != nil {
 				color.Set(color.FgRed)
 				fmt.Printf("Error going to sleep: %v\n", workErr.Error())
@@ -138,7 +132,7 @@ func interactiveMode(deviceFile string, devId uint16) error {
 			}
 		case "z":
 			fmt.Printf("query work status\n")
-			working, workErr := sensor.IsWorking()
+			working, workErr := sensor.IsWorking(ctx)
 			if workErr != nil {
 				color.Set(color.FgRed)
 				fmt.Printf("Error setting to work: %v\n", workErr.Error())
@@ -158,6 +152,16 @@ func interactiveMode(deviceFile string, devId uint16) error {
 				fmt.Printf("Error sending query: %v\n", workErr.Error())
 				color.Unset()
 			}
+		case "m":
+			fmt.Printf("querying measurement\n")
+			res, queryErr := sensor.QueryMeasurement(ctx)
+			if queryErr != nil {
+				color.Set(color.FgRed)
+				fmt.Printf("Error querying measurement: %v\n", queryErr.Error())
+				color.Unset()
+			} else {
+				fmt.Printf("%v\n", res.ToString())
+			}
 		case "p":
 			per, perErr := getIntegerUserInput("Enter period 0-30 minute:", 10, 0, 30)
 			if perErr != nil {
@@ -167,7 +171,7 @@ func interactiveMode(deviceFile string, devId uint16) error {
 			} else {
 
 				settings.Period = byte(per)
-				errSettings = sensor.SetSettings(settings) //Not capturing
+				errSettings = sensor.SetSettings(ctx, settings) //Not capturing
 				if errSettings != nil {
 					color.Set(color.FgRed)
 					fmt.Printf("Error setting settings: %v\n", errSettings.Error())
@@ -185,7 +189,7 @@ func interactiveMode(deviceFile string, devId uint16) error {
 			}
 		case "r":
 			fmt.Printf("syncing sensor settings..\n")
-			newSet, errSet := sensor.GetSettings()
+			newSet, errSet := sensor.GetSettings(ctx)
 			if errSet != nil {
 				color.Set(color.FgRed)
 				fmt.Printf("Error syncing settings: %v\n", errSet.Error())
@@ -196,6 +200,8 @@ func interactiveMode(deviceFile string, devId uint16) error {
 			}
 		case "t":
 			fmt.Printf("Settings on computer %#v\n", settings)
+		case "l":
+			fmt.Printf("Line: %v\nSensor: %v\n", ser.Stats(), sensor.Stats())
 		case "h":
 			printInteractiveHelp()
 		}
@@ -10,12 +10,14 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/hjkoskel/listserialports"
@@ -82,62 +84,19 @@ func getIntegerUserInput(prompt string, base int, minvalue int, maxvalue int) (i
 	return int(per), nil
 }
 
-const (
-	MEASUREDCOUNTERFILE     = "measuredcounter"
-	MEASUREDCOUNTERFILE_TMP = "measuredcounter.tmp"
-)
-
-func loadMeasurementCounterFromFile() (int, error) {
-	byt, errRead := os.ReadFile(MEASUREDCOUNTERFILE)
-	if errRead != nil {
-		return 0, fmt.Errorf("counter reading error %v", errRead.Error())
-	}
-	i, parseErr := strconv.ParseInt(string(byt), 10, 64)
-	if parseErr != nil {
-		return 0, fmt.Errorf("error parsing counter from file %v", parseErr.Error())
-	}
-	return int(i), nil
-}
-
-// Save with sync? bad?
-func saveMeasuremntCounterToFile(counter int) error {
-	f, err := os.Create(MEASUREDCOUNTERFILE_TMP)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	_, errW := io.WriteString(f, fmt.Sprintf("%v", counter)) //writes all.. so short
-	if errW != nil {
-		return errW
-	}
-	syncErr := f.Sync()
-	if syncErr != nil {
-		return syncErr
-	}
-	f.Close() //Do not care about error. If it is flushed
-
-	return os.Rename(MEASUREDCOUNTERFILE_TMP, MEASUREDCOUNTERFILE)
-}
-
 func main() {
 	pSerialDevice := flag.String("s", "", "serial device file")
 	pPeriod := flag.Int("p", -1, "set period 0=30sec, 1= 1min 2=2min....")
 	pDeviceId := flag.String("id", "FFFF", "device id in hex (filter)")
 	//pDebug := flag.Bool("debug", false, "debug packages mode")
 	pInteractive := flag.Bool("i", false, "interactive mode")
+	pDiscover := flag.Bool("discover", false, "scan bus, list all sensor IDs with firmware versions and settings")
+	pUsbSerial := flag.String("usbserial", "", "find serial port by USB serial number (from /dev/serial/by-id) after reconnect")
 	/*
 		pQueryMode := flag.Bool("q", false, "put query mode on (actively). Must do queries for getting data")
 		pActiveMode := flag.Bool("a", false, "put active mode (activile) report actively by itself")
 	*/
 
-	theMeasCounter, errLoadCounter := loadMeasurementCounterFromFile()
-	if errLoadCounter != nil {
-		fmt.Printf("Error loading measurement counter %v, start from 0\n", errLoadCounter)
-	} else {
-		fmt.Printf("Starting from point count %v\n", theMeasCounter)
-	}
-
 	flag.Parse()
 
 	serialDeviceFileName := string(*pSerialDevice)
@@ -171,8 +130,11 @@ func main() {
 		return
 	}*/
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	if *pInteractive {
-		err := interactiveMode(serialDeviceFileName, uint16(devId))
+		err := interactiveMode(ctx, serialDeviceFileName, uint16(devId))
 		if err != nil {
 			fmt.Printf("ERR=%v\n", err.Error())
 		}
@@ -181,12 +143,20 @@ func main() {
 	//Now using only one sensor. It would be possible to put multiple sensors with different IDs on same bus (not tested yet)
 	passive := int(*pPeriod) < 0
 
-	serialLink, serialInitErr := sds011.CreateLinuxSerial(serialDeviceFileName)
-	if serialInitErr != nil {
-		fmt.Printf("Initializing serial port %v failed %v\n", serialDeviceFileName, serialInitErr.Error())
-		return
-	}
-	fmt.Printf("Serial link is %#v\n", serialLink)
+	//Supervisor keeps reopening port if USB-serial adapter is unplugged
+	serialLink := sds011.CreateSerialSupervisor(serialDeviceFileName, *pUsbSerial)
+	go func() {
+		for {
+			event := <-serialLink.Events
+			if event.Connected && event.Err == nil {
+				color.Set(color.FgGreen)
+			} else {
+				color.Set(color.FgRed)
+			}
+			fmt.Printf("Serial link %s\n", event)
+			color.Unset()
+		}
+	}()
 
 	/*
 		go func() {
@@ -201,31 +171,55 @@ func main() {
 
 	sensorResults := make(chan sds011.Result, 3)
 
-	sensor := sds011.InitSds011(uint16(devId), passive, serialLink, sensorResults, theMeasCounter)
-	if int(*pPeriod) < 0 {
-		//No need to change
+	//Bus allows to detect other sensors on same line
+	bus := sds011.NewBus(serialLink)
+	sensor := bus.AddSensor(uint16(devId), passive, sensorResults, 0)
+	errLoadCounter := sensor.UseCounterStore(sds011.FileCounterStore{Dir: ".", LegacyFile: "measuredcounter"}, time.Millisecond*sds011.COUNTERFLUSHINTERVAL)
+	if errLoadCounter != nil {
+		fmt.Printf("Error loading measurement counter %v, start from 0\n", errLoadCounter)
 	} else {
-		//Ok to fail at this point
-		sensor.SetSettings(sds011.Sds011Settings{QueryMode: false, Period: byte(*pPeriod)}) //Active mode
+		fmt.Printf("Starting from point count %v\n", sensor.MeasurementCounter())
+	}
+	if !passive && !*pDiscover {
+		//Settings are written again if sensor was changed while link was down
+		serialLink.OnConnect = func() error {
+			return sensor.SetSettings(ctx, sds011.Sds011Settings{QueryMode: false, Period: byte(*pPeriod)}) //Active mode
+		}
 	}
 
 	go func() {
-		for {
-			errRun := sensor.Run()
-			fmt.Printf("error run %s\n", errRun)
-		}
+		busErr := bus.Run(ctx)
+		fmt.Printf("Bus stopped %s\n", busErr)
 	}()
 
+	if *pDiscover {
+		fmt.Printf("Scanning sensors...\n")
+		found, errDiscover := bus.Discover(ctx)
+		for _, info := range found {
+			fmt.Printf("%s\n", info)
+		}
+		if errDiscover != nil {
+			color.Set(color.FgRed)
+			fmt.Printf("Scan error %v\n", errDiscover.Error())
+			color.Unset()
+		}
+		fmt.Printf("%v sensors found\n", len(found))
+		bus.Close()
+		return
+	}
+
+	diag := sds011.NewDiagnostics()
 	go func() {
 		for {
-			res := <-sensorResults
-			color.Set(color.FgHiYellow)
-			fmt.Printf("Sensor have result %v\n", res.ToString())
-			color.Unset()
-			countSaveErr := saveMeasuremntCounterToFile(res.MeasurementCounter)
-			if countSaveErr != nil {
-				color.Set(color.FgHiRed)
-				fmt.Printf("counter save error %v\n", countSaveErr.Error())
+			select {
+			case res := <-sensorResults:
+				color.Set(color.FgHiYellow)
+				fmt.Printf("Sensor have result %v\n", res.ToString())
+				color.Unset()
+				diag.Feed(res)
+			case ev := <-diag.Events:
+				color.Set(color.FgRed)
+				fmt.Printf("SENSOR HEALTH %v\n", ev)
 				color.Unset()
 			}
 		}
@@ -240,13 +234,15 @@ func main() {
 				color.Set(color.FgRed)
 				fmt.Printf("\n\nSENSOR ERROR %v\n\n", errSensor.Error())
 				color.Unset()
+			} else {
+				fmt.Printf("Sensor data resumed\n")
 			}
 		}
 	}()
 
 	go func() { //Demo how autodetect can be implemented (optional)
 		for {
-			otherId := <-sensor.DetectedSensor
+			otherId := <-bus.UnknownIds
 			color.Set(color.FgMagenta)
 			fmt.Printf("Other sensor id %X detected\n", otherId)
 			color.Unset()
@@ -255,8 +251,11 @@ func main() {
 
 	fmt.Printf("Going to run\n")
 
-	for {
-		runErr := sensor.Run()
-		fmt.Printf("EXIT with %s\n", runErr)
+	runErr := sensor.Run(ctx) //Bad frames do not stop, those are reported on ErrorsCh
+	fmt.Printf("EXIT with %s\n", runErr)
+	countSaveErr := sensor.FlushCounter()
+	if countSaveErr != nil {
+		fmt.Printf("counter save error %v\n", countSaveErr.Error())
 	}
+	bus.Close()
 }
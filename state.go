@@ -0,0 +1,178 @@
+/*
+Sensor lifecycle state
+
+State is driven by recieved packets, reply timeouts, PowerLine and work mode changes.
+Transitions are pushed to StateChanges channel for UI and alerting
+*/
+
+package sds011
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	WARMUPTIME    = 30000 //milliseconds, fan and laser need this after wake up before readings are good
+	FAULTTIMEOUTS = 3     //Consecutive reply timeouts before faulted. Single lost reply on noisy bus is not fault
+)
+
+type SensorState int
+
+const (
+	STATE_UNKNOWN    SensorState = iota //Nothing recieved yet
+	STATE_CONNECTING                    //Run started or power switched on, waiting sensor
+	STATE_SLEEPING                      //Sensor told it is sleeping
+	STATE_WARMINGUP                     //Woke up less than WARMUPTIME ago
+	STATE_MEASURING
+	STATE_STALE      //Was measuring but data stopped coming. Set by watchdog, see checkWatchdog
+	STATE_FAULTED    //No reply to FAULTTIMEOUTS requests in row or link failed
+	STATE_POWEREDOFF //Power line is off
+)
+
+func (p SensorState) String() string {
+	switch p {
+	case STATE_UNKNOWN:
+		return "unknown"
+	case STATE_CONNECTING:
+		return "connecting"
+	case STATE_SLEEPING:
+		return "sleeping"
+	case STATE_WARMINGUP:
+		return "warming up"
+	case STATE_MEASURING:
+		return "measuring"
+	case STATE_STALE:
+		return "stale"
+	case STATE_FAULTED:
+		return "faulted"
+	case STATE_POWEREDOFF:
+		return "powered off"
+	}
+	return fmt.Sprintf("state %d", int(p))
+}
+
+type StateTransition struct {
+	From   SensorState
+	To     SensorState
+	Time   time.Time
+	Reason string
+}
+
+func (p StateTransition) String() string {
+	return fmt.Sprintf("%v -> %v: %v", p.From, p.To, p.Reason)
+}
+
+// State is what sensor is doing now
+func (p *Sds011) State() SensorState {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.state
+}
+
+// Must hold stateMu. Reports transition if state changes
+func (p *Sds011) setStateLocked(to SensorState, reason string) {
+	if p.state == to {
+		return
+	}
+	transition := StateTransition{From: p.state, To: to, Time: time.Now(), Reason: reason}
+	p.state = to
+	select {
+	case p.StateChanges <- transition:
+	default:
+	}
+}
+
+func (p *Sds011) setState(to SensorState, reason string) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.setStateLocked(to, reason)
+}
+
+// Must hold stateMu. Fan and laser started now
+func (p *Sds011) wakeLocked(reason string) {
+	p.tWake = time.Now()
+	p.setStateLocked(STATE_WARMINGUP, reason)
+}
+
+// Power line changed
+func (p *Sds011) statePower(enabled bool) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if !enabled {
+		p.setStateLocked(STATE_POWEREDOFF, "power line off")
+		return
+	}
+	if p.state == STATE_POWEREDOFF {
+		p.tWake = time.Now() //Sensor starts working after power up
+		p.setStateLocked(STATE_CONNECTING, "power line on")
+	}
+}
+
+// Work mode is known from reply. Commanded is true when work mode was written.
+// Sensor might have been left sleeping before state was known, so wake command always starts warm-up
+func (p *Sds011) stateWorkMode(working bool, commanded bool) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if p.state == STATE_POWEREDOFF {
+		return
+	}
+	if !working {
+		p.setStateLocked(STATE_SLEEPING, "sensor sleeping")
+		return
+	}
+	if p.state == STATE_SLEEPING || (commanded && p.state != STATE_WARMINGUP && p.state != STATE_MEASURING) {
+		p.wakeLocked("woke up")
+		return
+	}
+	if p.state != STATE_WARMINGUP && p.state != STATE_MEASURING {
+		p.setStateLocked(STATE_MEASURING, "sensor working")
+	}
+}
+
+// Sensor replied to command. Recovers from fault, work mode is not known yet
+func (p *Sds011) stateReplied() {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.timeouts = 0
+	if p.state == STATE_FAULTED || p.state == STATE_UNKNOWN {
+		p.setStateLocked(STATE_CONNECTING, "sensor replied")
+	}
+}
+
+// Measurement recieved. Returns true if measured inside warm-up window
+func (p *Sds011) stateData() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.tLastData = time.Now()
+	p.timeouts = 0
+	warmingUp := !p.tWake.IsZero() && time.Since(p.tWake) < time.Millisecond*WARMUPTIME
+	if p.state == STATE_POWEREDOFF {
+		return warmingUp //Reported as switch fail
+	}
+	switch {
+	case warmingUp:
+		p.setStateLocked(STATE_WARMINGUP, "data while warming up")
+	case p.state == STATE_STALE:
+		p.setStateLocked(STATE_MEASURING, "data recieved again")
+	case p.state == STATE_WARMINGUP:
+		p.setStateLocked(STATE_MEASURING, "warm up done")
+	default:
+		p.setStateLocked(STATE_MEASURING, "data recieved")
+	}
+	return warmingUp
+}
+
+// No reply in time. Sleeping sensor does not reply to data query, so that is not fault
+func (p *Sds011) stateTimeout(dataQuery bool, err error) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if p.state == STATE_POWEREDOFF || (dataQuery && p.state == STATE_SLEEPING) {
+		return
+	}
+	p.timeouts++
+	if p.timeouts < FAULTTIMEOUTS {
+		return
+	}
+	p.setStateLocked(STATE_FAULTED, fmt.Sprintf("%v timeouts in row, last %v", p.timeouts, err))
+}
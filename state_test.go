@@ -0,0 +1,142 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateTransitions(t *testing.T) {
+	conn := newFakeSensorConn(0xA160)
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 10), 0)
+	if sensor.State() != STATE_UNKNOWN {
+		t.Fatalf("initial state %v", sensor.State())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	expect := func(want SensorState) {
+		t.Helper()
+		select {
+		case tr := <-sensor.StateChanges:
+			if tr.To != want {
+				t.Fatalf("expected %v, got transition %v", want, tr)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no transition to %v", want)
+		}
+	}
+
+	expect(STATE_CONNECTING)
+	if _, errQuery := sensor.QueryMeasurement(ctx); errQuery != nil {
+		t.Fatal(errQuery)
+	}
+	expect(STATE_MEASURING)
+
+	if errWork := sensor.ChangeToWork(ctx, false); errWork != nil {
+		t.Fatal(errWork)
+	}
+	expect(STATE_SLEEPING)
+	if _, errQuery := sensor.QueryMeasurement(ctx); errQuery == nil {
+		t.Fatalf("sleeping sensor replied data")
+	}
+	if sensor.State() != STATE_SLEEPING {
+		t.Errorf("data query timeout while sleeping changed state to %v", sensor.State())
+	}
+
+	if errWork := sensor.ChangeToWork(ctx, true); errWork != nil {
+		t.Fatal(errWork)
+	}
+	expect(STATE_WARMINGUP)
+
+	sensor.PowerLine(false)
+	expect(STATE_POWEREDOFF)
+	sensor.PowerLine(true)
+	expect(STATE_CONNECTING)
+
+	//Sleeping state was not seen, like sensor left sleeping by earlier process
+	if errWork := sensor.ChangeToWork(ctx, true); errWork != nil {
+		t.Fatal(errWork)
+	}
+	expect(STATE_WARMINGUP)
+	if working, errWork := sensor.IsWorking(ctx); errWork != nil || !working {
+		t.Fatalf("is working %v err=%v", working, errWork)
+	}
+	if sensor.State() != STATE_WARMINGUP {
+		t.Errorf("work mode query changed state to %v", sensor.State())
+	}
+}
+
+func TestWarmUpPolicy(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	results := make(chan Result, 10)
+	sensor := InitSds011(0xA160, true, conn, results, 0)
+	sensor.WarmUp = WARMUP_HOLD
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	next := func() Result {
+		t.Helper()
+		select {
+		case res := <-results:
+			return res
+		case <-ctx.Done():
+			t.Fatalf("no result")
+		}
+		return Result{}
+	}
+
+	conn.packets <- NewPacket_DataReply(0xA160, 10, 20)
+	if res := next(); res.Quality != QUALITY_STABLE || res.SmallReg != 10 {
+		t.Errorf("expected stable reading, got %#v", res)
+	}
+
+	sensor.PowerLine(false)
+	sensor.PowerLine(true)
+	conn.packets <- NewPacket_DataReply(0xA160, 500, 900)
+	if res := next(); res.Quality != QUALITY_HELD || res.SmallReg != 10 || res.LargeReg != 20 {
+		t.Errorf("expected held stable reading, got %#v", res)
+	}
+}
+
+func TestStateFaultedAfterTimeouts(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 100)}
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 10), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	timeouts := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, errQuery := sensor.QueryMeasurement(ctx); !errors.Is(errQuery, ErrTimeout) {
+				t.Fatalf("expected timeout, got %v", errQuery)
+			}
+		}
+	}
+
+	timeouts(FAULTTIMEOUTS - 1)
+	if sensor.State() == STATE_FAULTED {
+		t.Errorf("faulted after %v timeouts", FAULTTIMEOUTS-1)
+	}
+	conn.packets <- NewPacket_DataReply(0xA160, 10, 20) //Sensor is alive, count starts again
+	for sensor.State() != STATE_MEASURING {
+		if ctx.Err() != nil {
+			t.Fatalf("data not processed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	timeouts(FAULTTIMEOUTS - 1)
+	if sensor.State() != STATE_MEASURING {
+		t.Errorf("state %v after lost replies", sensor.State())
+	}
+	timeouts(1)
+	if sensor.State() != STATE_FAULTED {
+		t.Errorf("not faulted after %v timeouts in row, state %v", FAULTTIMEOUTS, sensor.State())
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Link statistics
+
+For comparing cables and RS485 transceivers. LinuxConn counts what it sees on line,
+Sds011 counts frames for its own ID, errors reported to Run, request timeouts and request round trip latency
+*/
+
+package sds011
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds of latency histogram buckets. Last bucket counts slower ones
+var LatencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+}
+
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []int64 //One more than bounds, last is over largest bound
+	Sum    time.Duration
+	N      int64
+}
+
+func (p *LatencyHistogram) add(d time.Duration) {
+	if p.Counts == nil {
+		p.Bounds = LatencyBuckets
+		p.Counts = make([]int64, len(p.Bounds)+1)
+	}
+	i := 0
+	for i < len(p.Bounds) && p.Bounds[i] < d {
+		i++
+	}
+	p.Counts[i]++
+	p.Sum += d
+	p.N++
+}
+
+func (p LatencyHistogram) Mean() time.Duration {
+	if p.N == 0 {
+		return 0
+	}
+	return p.Sum / time.Duration(p.N)
+}
+
+func (p LatencyHistogram) String() string {
+	if p.N == 0 {
+		return "no requests"
+	}
+	parts := make([]string, len(p.Counts))
+	for i, count := range p.Counts {
+		if i < len(p.Bounds) {
+			parts[i] = fmt.Sprintf("<=%v:%v", p.Bounds[i], count)
+		} else {
+			parts[i] = fmt.Sprintf(">%v:%v", p.Bounds[len(p.Bounds)-1], count)
+		}
+	}
+	return fmt.Sprintf("mean %v %v", p.Mean(), strings.Join(parts, " "))
+}
+
+type LinkStats struct {
+	Frames         map[byte]int64 //Valid frames by command ID
+	BytesDiscarded int64          //Line noise before packet start
+	ChecksumErrors int64
+	SizeErrors     int64
+	FrameErrors    int64 //Other framing errors. Header, termination, unsupported command
+	Echoes         int64 //CMD frames recieved by Sds011 (host side). RX-TX short or RS485 echo. Decoder counts CMD only as frame
+	Timeouts       int64 //Requests without reply
+	Latency        LatencyHistogram
+}
+
+func (p LinkStats) String() string {
+	return fmt.Sprintf("frames CMD=%v RESPONSE=%v DATA=%v discarded=%vB checksum=%v size=%v frame=%v echo=%v timeouts=%v latency %v",
+		p.Frames[COMMANDID_CMD], p.Frames[COMMANDID_RESPONSE], p.Frames[COMMANDID_DATAREPLY],
+		p.BytesDiscarded, p.ChecksumErrors, p.SizeErrors, p.FrameErrors, p.Echoes, p.Timeouts, p.Latency)
+}
+
+type linkCounters struct {
+	mu    sync.Mutex
+	stats LinkStats
+}
+
+func newLinkCounters() *linkCounters {
+	return &linkCounters{stats: LinkStats{Frames: make(map[byte]int64)}}
+}
+
+func (p *linkCounters) frame(commandID byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Frames[commandID]++
+}
+
+func (p *linkCounters) discarded(n int) {
+	if n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.BytesDiscarded += int64(n)
+}
+
+// Classifies error. Other than parse errors are not counted
+func (p *linkCounters) parseError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var frameErr *FrameError
+	switch {
+	case errors.Is(err, ErrChecksum):
+		p.stats.ChecksumErrors++
+	case errors.Is(err, ErrEcho):
+		p.stats.Echoes++
+	case errors.As(err, &frameErr):
+		if frameErr.Size {
+			p.stats.SizeErrors++
+		} else {
+			p.stats.FrameErrors++
+		}
+	}
+}
+
+func (p *linkCounters) timeout() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Timeouts++
+}
+
+func (p *linkCounters) latency(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Latency.add(d)
+}
+
+// Copy that caller can keep
+func (p *linkCounters) snapshot() LinkStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := p.stats
+	result.Frames = make(map[byte]int64, len(p.stats.Frames))
+	for k, v := range p.stats.Frames {
+		result.Frames[k] = v
+	}
+	result.Latency.Counts = append([]int64(nil), p.stats.Latency.Counts...)
+	return result
+}
@@ -0,0 +1,99 @@
+package sds011
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// Reader as stream for tests
+type readOnlyStream struct {
+	io.Reader
+}
+
+func (p readOnlyStream) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (p readOnlyStream) Close() error {
+	return nil
+}
+
+func TestStreamConnStats(t *testing.T) {
+	good := NewPacket_DataReply(0xA160, 10, 20)
+	bad := good.ToBytes()
+	bad[len(bad)-2]++ //Checksum
+	var line []byte
+	line = append(line, 1, 2, 3) //Noise
+	line = append(line, good.ToBytes()...)
+	line = append(line, bad...)
+	conn := NewStreamConn(readOnlyStream{iotest.OneByteReader(bytes.NewReader(line))})
+
+	for range line {
+		conn.Recieve()
+	}
+	stats := conn.Stats()
+	if stats.Frames[COMMANDID_DATAREPLY] != 1 || stats.ChecksumErrors != 1 {
+		t.Errorf("invalid counts %v", stats)
+	}
+	if stats.BytesDiscarded < 3 {
+		t.Errorf("noise not counted %v", stats)
+	}
+}
+
+func TestSensorStats(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), errs: make(chan error, 3), sent: make(chan Packet, 10)}
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 10), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	conn.errs <- ErrChecksum
+	conn.errs <- &FrameError{Offset: 5, Size: true, Reason: "short"}
+	go func() {
+		<-conn.sent
+		conn.packets <- NewPacket_DataReply(0xA160, 10, 20)
+	}()
+	if _, errQuery := sensor.QueryMeasurement(ctx); errQuery != nil {
+		t.Fatal(errQuery)
+	}
+	sensor.QueryMeasurement(ctx) //No reply
+
+	stats := sensor.Stats()
+	if stats.Frames[COMMANDID_DATAREPLY] != 1 || stats.ChecksumErrors != 1 || stats.SizeErrors != 1 || stats.Timeouts != 1 {
+		t.Errorf("invalid counts %v", stats)
+	}
+	if stats.Latency.N != 1 {
+		t.Errorf("latency not recorded %v", stats.Latency)
+	}
+}
+
+// CMD is normal traffic for sensor side decoder, echo only for host
+func TestEchoStats(t *testing.T) {
+	cmd := NewPacket_QueryData(0xA160)
+	dec := NewDecoder(bytes.NewReader(cmd.ToBytes()))
+	pack := Packet{}
+	if found, err := dec.Decode(&pack); !found || err != nil {
+		t.Fatalf("CMD not decoded found=%v err=%v", found, err)
+	}
+	if stats := dec.Stats(); stats.Frames[COMMANDID_CMD] != 1 || stats.Echoes != 0 {
+		t.Errorf("decoder counts %v", stats)
+	}
+
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 10), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+	conn.packets <- cmd
+	for sensor.RecoverableErrorCount() == 0 && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	if stats := sensor.Stats(); stats.Frames[COMMANDID_CMD] != 1 || stats.Echoes != 1 {
+		t.Errorf("sensor counts %v", stats)
+	}
+}
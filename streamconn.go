@@ -0,0 +1,91 @@
+/*
+Conn over any io.ReadWriteCloser
+
+pty, net.Conn, pipe in tests or port from other serial library. Frames are found with Decoder.
+If stream supports read deadline, Recieve returns after STREAMREADTIMEOUT even if nothing comes, so Run can check context
+*/
+
+package sds011
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	STREAMREADTIMEOUT = 500 //milliseconds
+)
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type StreamConn struct {
+	rw         io.ReadWriteCloser
+	dec        *Decoder
+	noDeadline bool //Stream refused read deadline, blocking read
+	eofIsIdle  bool //Serial port gives EOF when nothing is recieved
+}
+
+func NewStreamConn(rw io.ReadWriteCloser) *StreamConn {
+	return &StreamConn{rw: rw, dec: NewDecoder(rw)}
+}
+
+// Stats is snapshot of what have been seen on stream
+func (p *StreamConn) Stats() LinkStats {
+	return p.dec.Stats()
+}
+
+func (p *StreamConn) Close() error {
+	return p.rw.Close()
+}
+
+func (p *StreamConn) SendBytes(data []byte) error {
+	_, err := p.rw.Write(data)
+	return err
+}
+
+func (p *StreamConn) Send(packet Packet) error {
+	return p.SendBytes(packet.ToBytes())
+}
+
+// Timeout from read deadline is not error
+func isTimeout(err error) bool {
+	var timeoutErr interface{ Timeout() bool }
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &timeoutErr) && timeoutErr.Timeout())
+}
+
+/*
+Recieve returns nil packet if there is no complete frame yet.
+Bad frames are returned as recoverable errors. End of stream is ErrDisconnected
+*/
+func (p *StreamConn) Recieve() (*Packet, error) {
+	if dl, ok := p.rw.(readDeadliner); ok && !p.noDeadline {
+		if dl.SetReadDeadline(time.Now().Add(time.Millisecond*STREAMREADTIMEOUT)) != nil {
+			p.noDeadline = true
+		}
+	}
+
+	rxPack := Packet{}
+	found, errDecode := p.dec.Decode(&rxPack)
+	if errDecode != nil {
+		switch {
+		case IsRecoverable(errDecode):
+			return nil, errDecode
+		case isTimeout(errDecode):
+		case errDecode == io.EOF:
+			if !p.eofIsIdle {
+				return nil, fmt.Errorf("%w: %w", ErrDisconnected, errDecode)
+			}
+		default: //Something more bad than eof happend
+			return nil, fmt.Errorf("error reading err=%w", errDecode)
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return &rxPack, nil
+}
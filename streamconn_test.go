@@ -0,0 +1,57 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStreamConnOverPipe(t *testing.T) {
+	sensorEnd, hostEnd := net.Pipe()
+	defer sensorEnd.Close()
+	go func() { //Replies data queries
+		dec := NewDecoder(sensorEnd)
+		for {
+			query := Packet{}
+			found, err := dec.Decode(&query)
+			if err != nil && !IsRecoverable(err) {
+				return
+			}
+			if found && query.CommandID == COMMANDID_CMD && query.Data[0] == FUNNUMBER_QUERYDATA {
+				reply := NewPacket_DataReply(query.DeviceID, 55, 66)
+				sensorEnd.Write(reply.ToBytes())
+			}
+		}
+	}()
+
+	conn := NewStreamConn(hostEnd)
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 3), 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- sensor.Run(ctx) }()
+
+	res, errQuery := sensor.QueryMeasurement(ctx)
+	if errQuery != nil {
+		t.Fatal(errQuery)
+	}
+	if res.SmallReg != 55 || res.LargeReg != 66 {
+		t.Errorf("invalid result %#v", res)
+	}
+
+	cancel() //Read deadline lets Run notice this without closing
+	select {
+	case err := <-runErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("run returned %v", err)
+		}
+	case <-time.After(2 * time.Millisecond * STREAMREADTIMEOUT):
+		t.Fatalf("run did not return")
+	}
+
+	sensorEnd.Close()
+	if _, errRecv := conn.Recieve(); errRecv == nil || IsRecoverable(errRecv) {
+		t.Errorf("closed stream gave %v", errRecv)
+	}
+}
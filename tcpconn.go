@@ -0,0 +1,56 @@
+//go:build !tinygo
+
+/*
+TCPConn for serial-over-network gateways like ser2net and ESP-Link transparent bridges.
+
+Same packet stream as LinuxConn. Lost connection is closed and dialed again with exponential backoff (see ReconnectConn),
+Recieve does not return error for that. Connect and disconnect events are reported on Events channel
+*/
+
+package sds011
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	TCPDIALTIMEOUT = 5000  //milliseconds
+	TCPKEEPALIVE   = 15000 //milliseconds, detects dead gateway when sensor is quiet
+)
+
+// Implements Conn. Never returns error from Recieve, unless closed
+type TCPConn struct {
+	*ReconnectConn
+	Addr string
+
+	dialer net.Dialer
+}
+
+// CreateTCPConn dials addr ("host:port"). Returns error if first dial fails. After that connection is kept up
+func CreateTCPConn(addr string) (*TCPConn, error) {
+	result := &TCPConn{
+		Addr: addr,
+		dialer: net.Dialer{
+			Timeout:   time.Millisecond * TCPDIALTIMEOUT,
+			KeepAlive: time.Millisecond * TCPKEEPALIVE,
+		},
+	}
+	result.ReconnectConn = NewReconnectConn(result.open)
+	conn, port, errDial := result.open()
+	if errDial != nil {
+		return nil, errDial
+	}
+	result.mu.Lock()
+	result.setConnLocked(conn, port)
+	result.mu.Unlock()
+	return result, nil
+}
+
+func (p *TCPConn) open() (Conn, string, error) {
+	c, errDial := p.dialer.Dial("tcp", p.Addr)
+	if errDial != nil {
+		return nil, p.Addr, errDial
+	}
+	return NewStreamConn(c), p.Addr, nil
+}
@@ -0,0 +1,88 @@
+//go:build !tinygo
+
+package sds011
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// Gateway that replies data queries. Drops first connection after first reply
+func serveFakeGateway(ln net.Listener) {
+	for nConn := 0; ; nConn++ {
+		c, errAccept := ln.Accept()
+		if errAccept != nil {
+			return
+		}
+		go func(c net.Conn, dropAfterReply bool) {
+			defer c.Close()
+			dec := NewDecoder(c)
+			for {
+				query := Packet{}
+				found, err := dec.Decode(&query)
+				if err != nil && !IsRecoverable(err) {
+					return
+				}
+				if found && query.Data[0] == FUNNUMBER_QUERYDATA {
+					reply := NewPacket_DataReply(query.DeviceID, 11, 22)
+					c.Write(reply.ToBytes())
+					if dropAfterReply {
+						return
+					}
+				}
+			}
+		}(c, nConn == 0)
+	}
+}
+
+func TestTCPConnRedial(t *testing.T) {
+	ln, errListen := net.Listen("tcp", "127.0.0.1:0")
+	if errListen != nil {
+		t.Skipf("no local listener %v", errListen)
+	}
+	defer ln.Close()
+	go serveFakeGateway(ln)
+
+	conn, errCreate := CreateTCPConn(ln.Addr().String())
+	if errCreate != nil {
+		t.Fatal(errCreate)
+	}
+	defer conn.Close()
+	conn.Backoff = Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 3), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	if _, errQuery := sensor.QueryMeasurement(ctx); errQuery != nil {
+		t.Fatalf("first query %v", errQuery)
+	}
+	select {
+	case ev := <-conn.Events:
+		if ev.Connected {
+			t.Fatalf("expected disconnect, got %v", ev)
+		}
+	case <-ctx.Done():
+		t.Fatalf("drop not noticed")
+	}
+
+	for { //Redialed transparently
+		res, errQuery := sensor.QueryMeasurement(ctx)
+		if errQuery == nil {
+			if res.SmallReg != 11 || res.LargeReg != 22 {
+				t.Errorf("invalid result %#v", res)
+			}
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("no reply after redial, %v", errQuery)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !conn.Connected() {
+		t.Errorf("not connected after reply")
+	}
+}
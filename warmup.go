@@ -0,0 +1,59 @@
+/*
+Warm-up handling
+
+Fan spins up and laser settles WARMUPTIME after sleep->work transition or power up. Readings during that are not reliable.
+Each Result is marked with quality and WarmUpPolicy tells what is done to readings inside warm-up window
+*/
+
+package sds011
+
+type ResultQuality int
+
+const (
+	QUALITY_STABLE    ResultQuality = iota
+	QUALITY_WARMINGUP               //Measured inside warm-up window
+	QUALITY_HELD                    //Warm-up reading replaced with last stable reading
+)
+
+func (p ResultQuality) String() string {
+	switch p {
+	case QUALITY_STABLE:
+		return "stable"
+	case QUALITY_WARMINGUP:
+		return "warming up"
+	case QUALITY_HELD:
+		return "held"
+	}
+	return "unknown quality"
+}
+
+type WarmUpPolicy int
+
+const (
+	WARMUP_FLAG WarmUpPolicy = iota //Pass readings with QUALITY_WARMINGUP
+	WARMUP_DROP                     //Do not push warm-up readings to result channel
+	WARMUP_HOLD                     //Push last stable reading marked QUALITY_HELD instead. Dropped if there is no stable reading yet
+)
+
+// Returns false if result must be dropped. Called from Run and DutyCycle goroutines
+func (p *Sds011) applyWarmUp(res Result) (Result, bool) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if res.Quality == QUALITY_STABLE {
+		p.lastStable = res
+		p.haveStable = true
+		return res, true
+	}
+	switch p.WarmUp {
+	case WARMUP_DROP:
+		return res, false
+	case WARMUP_HOLD:
+		if !p.haveStable {
+			return res, false
+		}
+		res.SmallReg = p.lastStable.SmallReg
+		res.LargeReg = p.lastStable.LargeReg
+		res.Quality = QUALITY_HELD
+	}
+	return res, true
+}
@@ -0,0 +1,105 @@
+/*
+Stale data watchdog
+
+In active mode result is expected once per period. If it is late more than grace (TX wire broken, sensor hanged)
+NoDataError is pushed on ErrorsCh once. When data comes again nil is pushed.
+Watchdog runs on own timer started by Run, so it fires even if conn Recieve blocks (dead wire on stream without read deadline)
+*/
+
+package sds011
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	WATCHDOGGRACE = 10000 //milliseconds, allowed lateness over period
+	WATCHDOGPOLL  = 1000  //milliseconds, max time between checks. Settings and state changes are noticed in this time
+)
+
+// NoDataError is reported when result is overdue. errors.Is(err, ErrNoData)
+type NoDataError struct {
+	Id       uint16
+	Age      time.Duration //Since last result
+	Expected time.Duration //Period plus grace
+}
+
+func (e *NoDataError) Error() string {
+	return fmt.Sprintf("%v, sensor %04X no result in %s (expected every %s)", ErrNoData, e.Id, e.Age.Round(time.Second), e.Expected)
+}
+
+func (e *NoDataError) Unwrap() error {
+	return ErrNoData
+}
+
+// Must hold stateMu. Data is not expected before run start or wake up
+func (p *Sds011) lastResultTimeLocked() time.Time {
+	t := p.tLastData
+	if t.Before(p.tWake) {
+		t = p.tWake
+	}
+	if t.Before(p.tRunStart) {
+		t = p.tRunStart
+	}
+	return t
+}
+
+// LastResultAge is time since last result. Counted from Run start or wake up if there is no result after those
+func (p *Sds011) LastResultAge() time.Duration {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	t := p.lastResultTimeLocked()
+	if t.IsZero() {
+		return 0
+	}
+	return time.Since(t)
+}
+
+// Checks until ctx is done. Started by Run
+func (p *Sds011) runWatchdog(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			timer.Reset(p.checkWatchdog())
+		}
+	}
+}
+
+// Reports only once per outage. Measuring sensor goes stale at same time. Returns time to next check
+func (p *Sds011) checkWatchdog() time.Duration {
+	poll := time.Millisecond * WATCHDOGPOLL
+	p.stateMu.Lock()
+	if p.settings.QueryMode || p.state == STATE_SLEEPING || p.state == STATE_POWEREDOFF || p.tRunStart.IsZero() {
+		p.stateMu.Unlock()
+		return poll
+	}
+	expected := p.settings.PeriodDuration() + p.WatchdogGrace
+	age := time.Since(p.lastResultTimeLocked())
+	overdue := expected < age
+	if overdue && (p.state == STATE_MEASURING || p.state == STATE_WARMINGUP) {
+		p.setStateLocked(STATE_STALE, fmt.Sprintf("no data in %s", age.Round(time.Second)))
+	}
+	p.stateMu.Unlock()
+
+	if overdue && atomic.CompareAndSwapInt32(&p.overdue, 0, 1) {
+		p.reportError(&NoDataError{Id: p.Id, Age: age, Expected: expected})
+	}
+	if overdue {
+		return poll
+	}
+	return min(expected-age, poll)
+}
+
+// Result recieved. Nil on ErrorsCh tells data have resumed
+func (p *Sds011) feedWatchdog() {
+	if atomic.CompareAndSwapInt32(&p.overdue, 1, 0) {
+		p.reportError(nil)
+	}
+}
@@ -0,0 +1,91 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	conn := &listConn{packets: make(chan Packet, 10), sent: make(chan Packet, 10)}
+	results := make(chan Result, 10)
+	sensor := InitSds011(0xA160, true, conn, results, 0)
+	sensor.WatchdogGrace = 50*time.Millisecond - sensor.settings.PeriodDuration() //Period 0 is 30s
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	select {
+	case err := <-sensor.ErrorsCh:
+		var noData *NoDataError
+		if !errors.Is(err, ErrNoData) || !errors.As(err, &noData) || noData.Id != 0xA160 {
+			t.Fatalf("expected no data error, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatalf("overdue result not reported")
+	}
+	if sensor.LastResultAge() < 50*time.Millisecond {
+		t.Errorf("last result age is %v", sensor.LastResultAge())
+	}
+
+	conn.packets <- NewPacket_DataReply(0xA160, 10, 20)
+	select {
+	case err := <-sensor.ErrorsCh:
+		if err != nil {
+			t.Fatalf("expected nil on resume, got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatalf("resume not reported")
+	}
+	if 50*time.Millisecond < sensor.LastResultAge() {
+		t.Errorf("last result age is %v after data", sensor.LastResultAge())
+	}
+	if sensor.State() != STATE_MEASURING {
+		t.Errorf("state %v after data", sensor.State())
+	}
+
+	select { //Data stops again. State and error must agree
+	case err := <-sensor.ErrorsCh:
+		if !errors.Is(err, ErrNoData) {
+			t.Fatalf("expected no data error, got %v", err)
+		}
+		if sensor.State() != STATE_STALE {
+			t.Errorf("no data reported but state is %v", sensor.State())
+		}
+	case <-ctx.Done():
+		t.Fatalf("second outage not reported")
+	}
+}
+
+// Stream without read deadline, read blocks until closed
+type blockingStream struct {
+	*io.PipeReader
+	io.Writer
+}
+
+func TestWatchdogBlockedRecieve(t *testing.T) {
+	reader, writer := io.Pipe()
+	conn := NewStreamConn(blockingStream{PipeReader: reader, Writer: io.Discard})
+	sensor := InitSds011(0xA160, true, conn, make(chan Result, 3), 0)
+	sensor.WatchdogGrace = 50*time.Millisecond - sensor.settings.PeriodDuration()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runDone := make(chan error)
+	go func() { runDone <- sensor.Run(ctx) }()
+
+	select {
+	case err := <-sensor.ErrorsCh:
+		if !errors.Is(err, ErrNoData) {
+			t.Fatalf("expected no data error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("dead wire not reported while Recieve blocks")
+	}
+	cancel()
+	writer.Close() //Unblocks Recieve
+	<-runDone
+}
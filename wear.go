@@ -0,0 +1,216 @@
+/*
+Laser and fan runtime accounting
+
+SDS011 laser is rated around 8000 hours. WearTracker accumulates working time from
+work/sleep changes, period setting and power line state. Working time is persisted thru WearStore
+*/
+
+package sds011
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	LASERRATEDHOURS     = 8000
+	WEARWARNINGFRACTION = 0.9   //Warning when this fraction of rated hours is used
+	WEARFLUSHINTERVAL   = 60000 //milliseconds, how often accumulated time is saved
+	SENSORWORKTIME      = 30    //seconds, sensor works this long per period if period is not 0
+)
+
+type WearRecord struct {
+	WorkingSeconds float64 `json:"workingSeconds"`
+}
+
+// WearStore stores working time. Keyed by device ID
+type WearStore interface {
+	LoadWear(id uint16) (WearRecord, error) //Zero record if nothing stored yet
+	SaveWear(id uint16, record WearRecord) error
+}
+
+// Reported with each Result. Zero if WearTracker is not in use
+type WearStatus struct {
+	HoursUsed      float64
+	RemainingHours float64 //Estimate, negative if rated life is already used
+	Warning        bool    //Time to order new sensor
+}
+
+func (p WearStatus) String() string {
+	warnString := ""
+	if p.Warning {
+		warnString = " WEARWARNING"
+	}
+	return fmt.Sprintf("used %.1fh remaining %.0fh%v", p.HoursUsed, p.RemainingHours, warnString)
+}
+
+type WearTracker struct {
+	RatedHours    float64
+	WarningHours  float64
+	FlushInterval time.Duration
+
+	mu           sync.Mutex
+	id           uint16
+	store        WearStore
+	record       WearRecord
+	working      bool    //Powered and not sleeping
+	dutyFraction float64 //Fraction of time fan and laser are on while working. Depends on period
+	tPrev        time.Time
+	tPrevFlush   time.Time
+}
+
+// NewWearTracker loads earlier working time from store. Tracker starts as working with period 0
+func NewWearTracker(id uint16, store WearStore) (*WearTracker, error) {
+	record, errLoad := store.LoadWear(id)
+	if errLoad != nil {
+		return nil, errLoad
+	}
+	return &WearTracker{
+		RatedHours:    LASERRATEDHOURS,
+		WarningHours:  LASERRATEDHOURS * WEARWARNINGFRACTION,
+		FlushInterval: time.Millisecond * WEARFLUSHINTERVAL,
+		id:            id,
+		store:         store,
+		record:        record,
+		working:       true,
+		dutyFraction:  1,
+		tPrev:         time.Now(),
+		tPrevFlush:    time.Now(),
+	}, nil
+}
+
+// Must hold mutex. Adds working time until now, in memory only
+func (p *WearTracker) accumulate() {
+	tNow := time.Now()
+	if p.working {
+		p.record.WorkingSeconds += tNow.Sub(p.tPrev).Seconds() * p.dutyFraction
+	}
+	p.tPrev = tNow
+}
+
+// Must hold mutex. Failed save is tried again on next call
+func (p *WearTracker) save() error {
+	errSave := p.store.SaveWear(p.id, p.record)
+	if errSave != nil {
+		p.tPrevFlush = time.Time{} //Due immediately
+		return errSave
+	}
+	p.tPrevFlush = time.Now()
+	return nil
+}
+
+// Must hold mutex. Saves if flush interval have passed
+func (p *WearTracker) accumulateAndSave() error {
+	p.accumulate()
+	if p.FlushInterval <= time.Since(p.tPrevFlush) {
+		return p.save()
+	}
+	return nil
+}
+
+// SetWorking on work/sleep change and on power line change
+func (p *WearTracker) SetWorking(working bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.accumulateAndSave()
+	p.working = working
+	return err
+}
+
+// SetPeriod when sensor period setting is known. With period sensor works only SENSORWORKTIME per period
+func (p *WearTracker) SetPeriod(period byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.accumulateAndSave()
+	p.dutyFraction = 1
+	if 0 < period {
+		p.dutyFraction = min(1, SENSORWORKTIME/(60*float64(period)))
+	}
+	return err
+}
+
+// Status is calculated in memory. Saving happens only in SetWorking, SetPeriod and Flush
+func (p *WearTracker) Status() WearStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accumulate()
+	used := p.record.WorkingSeconds / 3600
+	return WearStatus{
+		HoursUsed:      used,
+		RemainingHours: p.RatedHours - used,
+		Warning:        p.WarningHours <= used,
+	}
+}
+
+// Flush saves now. Call before exit
+func (p *WearTracker) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accumulate()
+	return p.save()
+}
+
+/*
+In memory store. For tests
+*/
+type MemoryWearStore struct {
+	mu      sync.Mutex
+	records map[uint16]WearRecord
+}
+
+func NewMemoryWearStore() *MemoryWearStore {
+	return &MemoryWearStore{records: make(map[uint16]WearRecord)}
+}
+
+func (p *MemoryWearStore) LoadWear(id uint16) (WearRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.records[id], nil
+}
+
+func (p *MemoryWearStore) SaveWear(id uint16, record WearRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records[id] = record
+	return nil
+}
+
+/*
+File store writes one json file per device ID in Dir
+*/
+type FileWearStore struct {
+	Dir string
+}
+
+func (p FileWearStore) fileName(id uint16) string {
+	return filepath.Join(p.Dir, fmt.Sprintf("wear_%04X.json", id))
+}
+
+func (p FileWearStore) LoadWear(id uint16) (WearRecord, error) {
+	byt, errRead := os.ReadFile(p.fileName(id))
+	if errRead != nil {
+		if errors.Is(errRead, os.ErrNotExist) {
+			return WearRecord{}, nil
+		}
+		return WearRecord{}, errRead
+	}
+	var result WearRecord
+	errParse := json.Unmarshal(byt, &result)
+	if errParse != nil {
+		return WearRecord{}, fmt.Errorf("invalid wear file %v: %w", p.fileName(id), errParse)
+	}
+	return result, nil
+}
+
+func (p FileWearStore) SaveWear(id uint16, record WearRecord) error {
+	byt, errMarshal := json.Marshal(record)
+	if errMarshal != nil {
+		return errMarshal
+	}
+	return writeFileAtomic(p.fileName(id), byt)
+}
@@ -0,0 +1,77 @@
+package sds011
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWearTrackerAccumulates(t *testing.T) {
+	store := NewMemoryWearStore()
+	store.SaveWear(0xA160, WearRecord{WorkingSeconds: 3600})
+
+	tracker, errTracker := NewWearTracker(0xA160, store)
+	if errTracker != nil {
+		t.Fatalf("creating tracker failed %v", errTracker)
+	}
+	tracker.WarningHours = 1
+
+	time.Sleep(20 * time.Millisecond)
+	tracker.SetWorking(false)
+	sleepingStatus := tracker.Status()
+	time.Sleep(20 * time.Millisecond)
+	if tracker.Status().HoursUsed != sleepingStatus.HoursUsed {
+		t.Errorf("time accumulated while sleeping")
+	}
+	if sleepingStatus.HoursUsed <= 1 || !sleepingStatus.Warning {
+		t.Errorf("invalid status %s", sleepingStatus)
+	}
+	if sleepingStatus.RemainingHours != LASERRATEDHOURS-sleepingStatus.HoursUsed {
+		t.Errorf("invalid remaining hours %s", sleepingStatus)
+	}
+
+	errFlush := tracker.Flush()
+	if errFlush != nil {
+		t.Fatalf("flush failed %v", errFlush)
+	}
+	record, _ := store.LoadWear(0xA160)
+	if record.WorkingSeconds <= 3600 {
+		t.Errorf("working time not saved %#v", record)
+	}
+}
+
+type failingWearStore struct {
+	MemoryWearStore
+	fail  bool
+	saves int
+}
+
+func (p *failingWearStore) SaveWear(id uint16, record WearRecord) error {
+	p.saves++
+	if p.fail {
+		return errors.New("disk full")
+	}
+	return p.MemoryWearStore.SaveWear(id, record)
+}
+
+func TestWearTrackerSave(t *testing.T) {
+	store := &failingWearStore{MemoryWearStore: *NewMemoryWearStore(), fail: true}
+	tracker, _ := NewWearTracker(0xA160, store)
+	tracker.FlushInterval = 0
+
+	tracker.Status()
+	if store.saves != 0 {
+		t.Errorf("status saved wear")
+	}
+	if errSet := tracker.SetWorking(true); errSet == nil {
+		t.Errorf("save error not returned")
+	}
+	store.fail = false
+	tracker.FlushInterval = time.Hour
+	if errSet := tracker.SetWorking(true); errSet != nil || store.saves != 2 {
+		t.Errorf("failed save not tried again, err=%v saves=%v", errSet, store.saves)
+	}
+	if errSet := tracker.SetWorking(true); errSet != nil || store.saves != 2 {
+		t.Errorf("saved before flush interval, err=%v saves=%v", errSet, store.saves)
+	}
+}
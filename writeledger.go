@@ -0,0 +1,141 @@
+/*
+Ledger of non-volatile writes (reporting mode, period, set id) per sensor
+
+Sensor flash wears out on each write. Library keeps count across restarts and refuses writes past configured budget
+*/
+
+package sds011
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type WriteCounts struct {
+	Lifetime   int          `json:"lifetime"`
+	Day        string       `json:"day"` //Local date YYYY-MM-DD when DayCount was counted
+	DayCount   int          `json:"dayCount"`
+	ByFunction map[byte]int `json:"byFunction"` //FUNNUMBER_ -> lifetime count
+}
+
+// Zero is unlimited
+type WriteBudget struct {
+	Daily    int
+	Lifetime int
+}
+
+// WriteLedger stores write counts. Keyed by device ID
+type WriteLedger interface {
+	LoadWrites(id uint16) (WriteCounts, error) //Zero counts if nothing stored yet
+	SaveWrites(id uint16, counts WriteCounts) error
+}
+
+// BudgetError is returned when write is refused. errors.Is(err, ErrWriteBudget) works
+type BudgetError struct {
+	Id    uint16
+	Daily bool //Daily or lifetime limit
+	Limit int
+	Used  int
+}
+
+func (e *BudgetError) Error() string {
+	limitName := "lifetime"
+	if e.Daily {
+		limitName = "daily"
+	}
+	return fmt.Sprintf("sensor %04X %v write budget %v used (%v writes)", e.Id, limitName, e.Limit, e.Used)
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrWriteBudget
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// Today tells writes made today. DayCount is from some earlier day if no writes today
+func (p *WriteCounts) Today() int {
+	if p.Day != today() {
+		return 0
+	}
+	return p.DayCount
+}
+
+func (p *WriteCounts) add(fun byte) {
+	if p.Day != today() {
+		p.Day = today()
+		p.DayCount = 0
+	}
+	p.DayCount++
+	p.Lifetime++
+	if p.ByFunction == nil {
+		p.ByFunction = make(map[byte]int)
+	}
+	p.ByFunction[fun]++
+}
+
+/*
+In memory ledger. For tests and for systems without storage
+*/
+type MemoryWriteLedger struct {
+	mu     sync.Mutex
+	counts map[uint16]WriteCounts
+}
+
+func NewMemoryWriteLedger() *MemoryWriteLedger {
+	return &MemoryWriteLedger{counts: make(map[uint16]WriteCounts)}
+}
+
+func (p *MemoryWriteLedger) LoadWrites(id uint16) (WriteCounts, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[id], nil
+}
+
+func (p *MemoryWriteLedger) SaveWrites(id uint16, counts WriteCounts) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[id] = counts
+	return nil
+}
+
+/*
+File ledger writes one json file per device ID in Dir
+*/
+type FileWriteLedger struct {
+	Dir string
+}
+
+func (p FileWriteLedger) fileName(id uint16) string {
+	return filepath.Join(p.Dir, fmt.Sprintf("writes_%04X.json", id))
+}
+
+func (p FileWriteLedger) LoadWrites(id uint16) (WriteCounts, error) {
+	byt, errRead := os.ReadFile(p.fileName(id))
+	if errRead != nil {
+		if errors.Is(errRead, os.ErrNotExist) {
+			return WriteCounts{}, nil
+		}
+		return WriteCounts{}, errRead
+	}
+	var result WriteCounts
+	errParse := json.Unmarshal(byt, &result)
+	if errParse != nil {
+		return WriteCounts{}, fmt.Errorf("invalid write ledger file %v: %w", p.fileName(id), errParse)
+	}
+	return result, nil
+}
+
+func (p FileWriteLedger) SaveWrites(id uint16, counts WriteCounts) error {
+	byt, errMarshal := json.Marshal(counts)
+	if errMarshal != nil {
+		return errMarshal
+	}
+	return writeFileAtomic(p.fileName(id), byt)
+}
@@ -0,0 +1,66 @@
+package sds011
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteBudget(t *testing.T) {
+	conn := newFakeSensorConn(0xA160)
+	sensor := InitSds011(0xA160, false, conn, make(chan Result, 3), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go sensor.Run(ctx)
+
+	ledger := FileWriteLedger{Dir: t.TempDir()}
+	sensor.UseWriteLedger(ledger, WriteBudget{Lifetime: 1})
+
+	errSet := sensor.SetSettings(ctx, Sds011Settings{Period: 3})
+	if errSet != nil {
+		t.Fatalf("first write failed %v", errSet)
+	}
+	errSet = sensor.SetSettings(ctx, Sds011Settings{Period: 4})
+	var budgetErr *BudgetError
+	if !errors.Is(errSet, ErrWriteBudget) || !errors.As(errSet, &budgetErr) || budgetErr.Daily {
+		t.Errorf("expected lifetime budget error, got %v", errSet)
+	}
+	if conn.writeCount() != 1 {
+		t.Errorf("refused write was sent to sensor")
+	}
+
+	counts, errCounts := FileWriteLedger{Dir: ledger.Dir}.LoadWrites(0xA160)
+	if errCounts != nil {
+		t.Fatalf("loading counts failed %v", errCounts)
+	}
+	if counts.Lifetime != 1 || counts.Today() != 1 || counts.ByFunction[FUNNUMBER_PERIOD] != 1 {
+		t.Errorf("invalid counts %#v", counts)
+	}
+}
+
+func TestWriteBudgetConcurrent(t *testing.T) {
+	sensor := InitSds011(0xA160, false, newFakeSensorConn(0xA160), make(chan Result, 3), 0)
+	ledger := NewMemoryWriteLedger()
+	sensor.UseWriteLedger(ledger, WriteBudget{Daily: 5})
+
+	var wg sync.WaitGroup
+	var allowed int32
+	for i := 0; i < 20; i++ { //Like SetSettings and Reconciler at same time
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sensor.reserveWrite(FUNNUMBER_PERIOD) == nil {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	counts, _ := ledger.LoadWrites(0xA160)
+	if allowed != 5 || counts.Today() != 5 {
+		t.Errorf("%v writes allowed, %v counted. Budget is 5", allowed, counts.Today())
+	}
+}